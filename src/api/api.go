@@ -0,0 +1,331 @@
+package api
+
+import (
+	"Driver-go/elevio"
+	"crypto/subtle"
+	"elevator/types"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+ * Time the main loop has to answer a request
+ */
+const REQUEST_TIMEOUT = 2000 // ms
+
+type RequestKind int
+
+const (
+	RQ_Status RequestKind = iota
+	RQ_SetInService
+	RQ_Resync
+	RQ_SetIndependent
+	RQ_FireRecall
+	RQ_FireService
+)
+
+/*
+ * Requests are handled by the main loop, which owns the elevator state.
+ * InService is only used by RQ_SetInService, Independent by RQ_SetIndependent,
+ * Recall by RQ_FireRecall and FireService by RQ_FireService.
+ */
+type Request struct {
+	Kind        RequestKind
+	InService   bool
+	Independent bool
+	Recall      bool
+	FireService bool
+	Reply       chan Reply
+}
+
+type Reply struct {
+	Status Status
+	Err    error
+}
+
+/*
+ * Snapshot of the node taken by the main loop
+ */
+type Status struct {
+	Config    types.ElevConfig
+	State     types.ElevState
+	Behaviour types.ElevBehaviour
+	Peers     []string
+}
+
+type server struct {
+	token     string
+	numFloors int
+	requests  chan<- Request
+	buttons   chan<- elevio.ButtonEvent
+}
+
+var buttonTypes = map[string]elevio.ButtonType{
+	"hall_up":   elevio.BT_HallUp,
+	"hall_down": elevio.BT_HallDown,
+	"cab":       elevio.BT_Cab,
+}
+
+/*
+ * Adds the API endpoints to the mux:
+ *   GET  /status   node state, configuration, ring neighbour and peers
+ *   GET  /orders   order registry
+ *   POST /calls    {"floor": 2, "button": "hall_up"} pressed as a button on the node
+ *   POST /service  {"inService": false} takes the car out of service
+ *   POST /resync   merges the order lists of the ring again
+ *   POST /independent  {"independent": true} reserves the car for cab calls only
+ *   POST /fire/recall   {"recall": true} recalls every car in the ring (Phase I)
+ *   POST /fire/service  {"active": true} hands the car to a firefighter (Phase II)
+ *
+ * POST endpoints require the header "Authorization: Bearer <token>",
+ * and are disabled if the token is empty.
+ */
+func Register(
+	mux *http.ServeMux,
+	token string,
+	elevConfig *types.ElevConfig,
+	requests chan<- Request,
+	buttons chan<- elevio.ButtonEvent,
+) {
+
+	s := &server{
+		token:     token,
+		numFloors: elevConfig.NumFloors,
+		requests:  requests,
+		buttons:   buttons,
+	}
+
+	mux.HandleFunc("/status", s.get(s.status))
+	mux.HandleFunc("/orders", s.get(s.orders))
+	mux.HandleFunc("/calls", s.post(s.call))
+	mux.HandleFunc("/service", s.post(s.service))
+	mux.HandleFunc("/resync", s.post(s.resync))
+	mux.HandleFunc("/independent", s.post(s.independent))
+	mux.HandleFunc("/fire/recall", s.post(s.fireRecall))
+	mux.HandleFunc("/fire/service", s.post(s.fireService))
+}
+
+func (s *server) get(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("use GET"))
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func (s *server) post(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+			return
+		}
+
+		if !s.authorised(r) {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func (s *server) authorised(r *http.Request) bool {
+	if len(s.token) == 0 {
+		return false
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	return found && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+/*
+ * Passes the request to the main loop and waits for the reply
+ */
+func (s *server) send(request Request) (Reply, error) {
+	request.Reply = make(chan Reply, 1)
+
+	timeout := time.After(REQUEST_TIMEOUT * time.Millisecond)
+
+	select {
+	case s.requests <- request:
+	case <-timeout:
+		return Reply{}, errors.New("node is busy")
+	}
+
+	select {
+	case reply := <-request.Reply:
+		return reply, reply.Err
+	case <-timeout:
+		return Reply{}, errors.New("node is busy")
+	}
+}
+
+func (s *server) status(w http.ResponseWriter, r *http.Request) {
+	reply, err := s.send(Request{Kind: RQ_Status})
+
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	writeJson(w, reply.Status)
+}
+
+func (s *server) orders(w http.ResponseWriter, r *http.Request) {
+	reply, err := s.send(Request{Kind: RQ_Status})
+
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	writeJson(w, reply.Status.State.Orders)
+}
+
+func (s *server) call(w http.ResponseWriter, r *http.Request) {
+	var call struct {
+		Floor  int
+		Button string
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&call)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	btn, valid := buttonTypes[call.Button]
+
+	if !valid || 0 > call.Floor || call.Floor >= s.numFloors {
+		writeError(w, http.StatusBadRequest, errors.New("invalid floor or button"))
+		return
+	}
+
+	/*
+	 * The call is handled exactly like a button pressed on the panel
+	 */
+	select {
+	case s.buttons <- elevio.ButtonEvent{Floor: call.Floor, Button: btn}:
+		w.WriteHeader(http.StatusAccepted)
+	case <-time.After(REQUEST_TIMEOUT * time.Millisecond):
+		writeError(w, http.StatusServiceUnavailable, errors.New("node is busy"))
+	}
+}
+
+func (s *server) service(w http.ResponseWriter, r *http.Request) {
+	var service struct {
+		InService bool
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&service)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, err = s.send(Request{Kind: RQ_SetInService, InService: service.InService})
+
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) independent(w http.ResponseWriter, r *http.Request) {
+	var independent struct {
+		Independent bool
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&independent)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, err = s.send(Request{Kind: RQ_SetIndependent, Independent: independent.Independent})
+
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) fireRecall(w http.ResponseWriter, r *http.Request) {
+	var recall struct {
+		Recall bool
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&recall)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, err = s.send(Request{Kind: RQ_FireRecall, Recall: recall.Recall})
+
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) fireService(w http.ResponseWriter, r *http.Request) {
+	var fireService struct {
+		Active bool
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&fireService)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, err = s.send(Request{Kind: RQ_FireService, FireService: fireService.Active})
+
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) resync(w http.ResponseWriter, r *http.Request) {
+	_, err := s.send(Request{Kind: RQ_Resync})
+
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func writeJson(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,231 @@
+package calib
+
+import (
+	"elevator/clock"
+	"elevator/types"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+/*
+ * Number of samples each rolling mean is computed over
+ */
+const WINDOW = 20
+
+/*
+ * Travel samples longer than this many times the default travel time
+ * are ignored, as the car was most likely stuck between floors.
+ * Door samples longer than this many times the default door time
+ * are ignored, as the door was most likely held open.
+ */
+const OUTLIER_FACTOR = 3
+
+/*
+ * Learns the travel time between each pair of floors, the time the door
+ * is kept open and the extra time it takes to start from a stop,
+ * from the floor sensor and from the motor and door outputs.
+ */
+type Model struct {
+	defaultTravelTime int
+	defaultDoorTime   int
+
+	segments     []rollingMean
+	doorDwell    rollingMean
+	stopOverhead rollingMean
+
+	lastFloor    int
+	lastFloorAt  time.Time
+	departedAt   time.Time
+	departed     bool
+	doorOpen     bool
+	doorOpenedAt time.Time
+	discarded    bool
+}
+
+type rollingMean struct {
+	samples []int
+	next    int
+}
+
+func (r *rollingMean) add(sample int) {
+	if len(r.samples) < WINDOW {
+		r.samples = append(r.samples, sample)
+		return
+	}
+
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % WINDOW
+}
+
+/*
+ * Returns 0 if there are no samples
+ */
+func (r *rollingMean) mean() int {
+	if len(r.samples) == 0 {
+		return 0
+	}
+
+	sum := 0
+
+	for _, sample := range r.samples {
+		sum += sample
+	}
+
+	return sum / len(r.samples)
+}
+
+func New(elevConfig *types.ElevConfig, defaultTravelTime int) *Model {
+	return &Model{
+		defaultTravelTime: defaultTravelTime,
+		defaultDoorTime:   elevConfig.DoorOpenDuration,
+		segments:          make([]rollingMean, max(elevConfig.NumFloors-1, 0)),
+		lastFloor:         -1,
+	}
+}
+
+/*
+ * The car starts moving from a stop
+ */
+func (m *Model) OnDeparture() {
+	m.departed = true
+	m.departedAt = clock.Now()
+}
+
+func (m *Model) OnFloorArrival(floor int) {
+	now := clock.Now()
+
+	isNeighbour := m.lastFloor == floor+1 || m.lastFloor == floor-1
+
+	if 0 <= m.lastFloor && isNeighbour {
+		segment := &m.segments[min(floor, m.lastFloor)]
+
+		if m.departed {
+			elapsed := int(now.Sub(m.departedAt).Milliseconds())
+			overhead := elapsed - m.segmentTime(segment)
+
+			if 0 <= overhead && elapsed < OUTLIER_FACTOR*m.defaultTravelTime {
+				m.stopOverhead.add(overhead)
+			}
+		} else {
+			elapsed := int(now.Sub(m.lastFloorAt).Milliseconds())
+
+			if elapsed < OUTLIER_FACTOR*m.defaultTravelTime {
+				segment.add(elapsed)
+			}
+		}
+	}
+
+	m.lastFloor = floor
+	m.lastFloorAt = now
+	m.departed = false
+}
+
+/*
+ * Called with the door lamp output, the dwell time is measured
+ * from the door opening until it closes, obstructions included
+ */
+func (m *Model) OnDoor(open bool) {
+	if open == m.doorOpen {
+		return
+	}
+
+	m.doorOpen = open
+
+	if open {
+		m.doorOpenedAt = clock.Now()
+		m.discarded = false
+		return
+	}
+
+	elapsed := int(clock.Since(m.doorOpenedAt).Milliseconds())
+
+	if !m.discarded && elapsed < OUTLIER_FACTOR*m.defaultDoorTime {
+		m.doorDwell.add(elapsed)
+	}
+}
+
+/*
+ * The door is held open for another reason than passengers,
+ * so the time it has been open is not measured as a dwell time
+ */
+func (m *Model) Discard() {
+	m.discarded = m.doorOpen
+}
+
+func (m *Model) segmentTime(segment *rollingMean) int {
+	if travelTime := segment.mean(); travelTime > 0 {
+		return travelTime
+	}
+
+	return m.defaultTravelTime
+}
+
+/*
+ * Learned times for the cost function, 0 where nothing has been measured
+ */
+func (m *Model) TravelTimes() types.TravelTimes {
+	travelTimes := types.TravelTimes{
+		Segments:     make([]int, len(m.segments)),
+		DoorDwell:    m.doorDwell.mean(),
+		StopOverhead: m.stopOverhead.mean(),
+	}
+
+	for i := range m.segments {
+		travelTimes.Segments[i] = m.segments[i].mean()
+	}
+
+	return travelTimes
+}
+
+type SegmentReport struct {
+	From       int
+	To         int
+	TravelTime int
+	Samples    int
+}
+
+type Report struct {
+	GeneratedAt         time.Time
+	DefaultTravelTime   int
+	DefaultDoorTime     int
+	Segments            []SegmentReport
+	DoorDwell           int
+	DoorDwellSamples    int
+	StopOverhead        int
+	StopOverheadSamples int
+}
+
+func (m *Model) Report() Report {
+	report := Report{
+		GeneratedAt:         clock.Now(),
+		DefaultTravelTime:   m.defaultTravelTime,
+		DefaultDoorTime:     m.defaultDoorTime,
+		Segments:            make([]SegmentReport, len(m.segments)),
+		DoorDwell:           m.doorDwell.mean(),
+		DoorDwellSamples:    len(m.doorDwell.samples),
+		StopOverhead:        m.stopOverhead.mean(),
+		StopOverheadSamples: len(m.stopOverhead.samples),
+	}
+
+	for i := range m.segments {
+		report.Segments[i] = SegmentReport{
+			From:       i,
+			To:         i + 1,
+			TravelTime: m.segments[i].mean(),
+			Samples:    len(m.segments[i].samples),
+		}
+	}
+
+	return report
+}
+
+func (m *Model) WriteReport(path string) error {
+	encodedReport, err := json.MarshalIndent(m.Report(), "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, encodedReport, 0644)
+}
@@ -0,0 +1,73 @@
+package calib
+
+import (
+	"elevator/clock"
+	"elevator/types"
+	"testing"
+	"time"
+)
+
+var elevConfig = &types.ElevConfig{
+	NumFloors:        4,
+	DoorOpenDuration: 3000,
+}
+
+func TestDoorDwell(t *testing.T) {
+	start := time.UnixMilli(100000)
+	clock.Set(start)
+
+	model := New(elevConfig, 2000)
+
+	model.OnDoor(true)
+	clock.Set(start.Add(3500 * time.Millisecond))
+	model.OnDoor(false)
+
+	if dwell := model.TravelTimes().DoorDwell; dwell != 3500 {
+		t.Errorf("got dwell %d, want 3500", dwell)
+	}
+}
+
+/*
+ * The car is taken out of service with its door open
+ * and put back in service before the door closes
+ */
+func TestDiscardDoorHeldOpen(t *testing.T) {
+	start := time.UnixMilli(100000)
+	clock.Set(start)
+
+	model := New(elevConfig, 2000)
+
+	model.OnDoor(true)
+	model.Discard()
+
+	clock.Set(start.Add(5000 * time.Millisecond))
+	model.OnDoor(true)
+	model.OnDoor(false)
+
+	if samples := model.Report().DoorDwellSamples; samples != 0 {
+		t.Errorf("got %d dwell samples, want the door held open discarded", samples)
+	}
+
+	model.OnDoor(true)
+	clock.Set(start.Add(8000 * time.Millisecond))
+	model.OnDoor(false)
+
+	if dwell := model.TravelTimes().DoorDwell; dwell != 3000 {
+		t.Errorf("got dwell %d after the car is back in service, want 3000", dwell)
+	}
+}
+
+func TestDoorDwellOutlier(t *testing.T) {
+	start := time.UnixMilli(100000)
+	clock.Set(start)
+
+	model := New(elevConfig, 2000)
+
+	model.OnDoor(true)
+	clock.Set(start.Add(5 * time.Minute))
+	model.OnDoor(false)
+
+	if samples := model.Report().DoorDwellSamples; samples != 0 {
+		t.Errorf("got %d dwell samples, want the door held for minutes ignored", samples)
+	}
+}
@@ -0,0 +1,35 @@
+package clock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * Time seen by the order and travel time logic.
+ * The main loop stops the clock at the time each input is taken,
+ * so everything done for one input happens at the same time,
+ * and a journal replay sees the same times as the live node.
+ */
+var stoppedAt atomic.Int64
+
+func Now() time.Time {
+	unixNano := stoppedAt.Load()
+
+	if unixNano == 0 {
+		return time.Now()
+	}
+
+	return time.Unix(0, unixNano)
+}
+
+func Since(t time.Time) time.Duration {
+	return Now().Sub(t)
+}
+
+/*
+ * Stops the clock at the given time until it is set again
+ */
+func Set(t time.Time) {
+	stoppedAt.Store(t.UnixNano())
+}
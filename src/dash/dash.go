@@ -0,0 +1,339 @@
+package dash
+
+import (
+	"Driver-go/elevio"
+	"Network-go/bcast"
+	"elevator/types"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+/*
+ * A car is shown as offline when no status has been received for this long
+ */
+const STATUS_TIMEOUT = 2000 // ms
+
+/*
+ * Message rates are averaged over this window
+ */
+const RATE_WINDOW = 5000 // ms
+
+var MSG_NAMES = []string{"bid", "assign", "served", "sync", "census", "reassign", "fire", "mode"}
+
+type car struct {
+	status   types.CarStatus
+	lastSeen time.Time
+}
+
+type dashboard struct {
+	cars     map[int]*car
+	messages map[string][]time.Time
+}
+
+/*
+ * Shows every car in a shaft diagram, along with the ring and the message rates.
+ * The dashboard only listens, so it can run anywhere on the network.
+ */
+func Run(args []string, bcastPort int, statusPort int) {
+	flags := flag.NewFlagSet("dash", flag.ExitOnError)
+	refresh := flags.Int("refresh", 250, "Milliseconds between redraws")
+	flags.Parse(args)
+
+	statusRx := make(chan types.CarStatus)
+
+	bidRx := make(chan types.Msg[types.Bid])
+	assignRx := make(chan types.Msg[types.Assign])
+	servedRx := make(chan types.Msg[types.Served])
+	syncRx := make(chan types.Msg[types.Sync])
+	censusRx := make(chan types.Msg[types.Census])
+	reassignRx := make(chan types.Msg[types.Reassign])
+	fireRx := make(chan types.Msg[types.Fire])
+	modeRx := make(chan types.Msg[types.Mode])
+
+	go bcast.Receiver(statusPort, statusRx)
+	go bcast.Receiver(bcastPort, bidRx, assignRx, servedRx, syncRx, censusRx, reassignRx, fireRx, modeRx)
+
+	d := dashboard{
+		cars:     make(map[int]*car),
+		messages: make(map[string][]time.Time),
+	}
+
+	redraw := time.NewTicker(time.Duration(max(*refresh, 10)) * time.Millisecond)
+
+	for {
+		select {
+		case status := <-statusRx:
+			d.cars[status.NodeID] = &car{status: status, lastSeen: time.Now()}
+
+		case <-bidRx:
+			d.countMessage("bid")
+		case <-assignRx:
+			d.countMessage("assign")
+		case <-servedRx:
+			d.countMessage("served")
+		case <-syncRx:
+			d.countMessage("sync")
+		case <-censusRx:
+			d.countMessage("census")
+		case <-reassignRx:
+			d.countMessage("reassign")
+		case <-fireRx:
+			d.countMessage("fire")
+		case <-modeRx:
+			d.countMessage("mode")
+
+		case <-redraw.C:
+			fmt.Print("\033[2J\033[H" + d.render())
+		}
+	}
+}
+
+func (d *dashboard) countMessage(name string) {
+	d.messages[name] = append(d.messages[name], time.Now())
+}
+
+/*
+ * Messages per second, every hop around the ring is counted
+ */
+func (d *dashboard) rate(name string) float64 {
+	windowStart := time.Now().Add(-RATE_WINDOW * time.Millisecond)
+
+	d.messages[name] = slices.DeleteFunc(d.messages[name], func(sentAt time.Time) bool {
+		return sentAt.Before(windowStart)
+	})
+
+	return float64(len(d.messages[name])) / (RATE_WINDOW / 1000)
+}
+
+func (d *dashboard) nodeIDs() []int {
+	nodeIDs := make([]int, 0, len(d.cars))
+
+	for nodeID := range d.cars {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+
+	slices.Sort(nodeIDs)
+
+	return nodeIDs
+}
+
+func (c *car) online() bool {
+	return time.Since(c.lastSeen) < STATUS_TIMEOUT*time.Millisecond
+}
+
+func (c *car) hasOrder(floor int, btn elevio.ButtonType) bool {
+	return slices.Contains(c.status.Orders, elevio.ButtonEvent{Floor: floor, Button: btn})
+}
+
+func (d *dashboard) render() string {
+	var out strings.Builder
+
+	nodeIDs := d.nodeIDs()
+
+	numFloors := 0
+	numOnline := 0
+
+	for _, nodeID := range nodeIDs {
+		numFloors = max(numFloors, d.cars[nodeID].status.NumFloors)
+
+		if d.cars[nodeID].online() {
+			numOnline++
+		}
+	}
+
+	fmt.Fprintf(&out, "  Elevator cluster | %d of %d cars online | %s\n\n",
+		numOnline,
+		len(nodeIDs),
+		time.Now().Format("15:04:05"),
+	)
+
+	if len(nodeIDs) == 0 {
+		out.WriteString("  Waiting for status from the cars...\n")
+		return out.String()
+	}
+
+	/*
+	 * Shaft diagram, top floor first.
+	 * Hall calls are listed with the car they are assigned to,
+	 * and * marks a cab call in the shaft of the car.
+	 */
+	out.WriteString("  Floor | Hall calls   |")
+
+	for _, nodeID := range nodeIDs {
+		fmt.Fprintf(&out, " Car %-3d|", nodeID)
+	}
+
+	out.WriteString("\n")
+
+	for floor := numFloors - 1; floor >= 0; floor-- {
+		fmt.Fprintf(&out, "  %5d | %-12s |", floor, d.hallCalls(floor))
+
+		for _, nodeID := range nodeIDs {
+			fmt.Fprintf(&out, " %-7s|", d.cars[nodeID].cell(floor))
+		}
+
+		out.WriteString("\n")
+	}
+
+	out.WriteString("\n  [^] moving up  [v] moving down  [ ] idle  ]=[ door open  [!] obstructed  [X] stuck  * cab call\n\n")
+
+	for _, nodeID := range nodeIDs {
+		out.WriteString("  " + d.cars[nodeID].describe() + "\n")
+	}
+
+	fmt.Fprintf(&out, "\n  Ring: %s\n\n  Messages per second:", d.ring())
+
+	for _, name := range MSG_NAMES {
+		fmt.Fprintf(&out, " %s %.1f |", name, d.rate(name))
+	}
+
+	out.WriteString("\n")
+
+	return out.String()
+}
+
+func (d *dashboard) hallCalls(floor int) string {
+	var calls []string
+
+	for _, nodeID := range d.nodeIDs() {
+		c := d.cars[nodeID]
+
+		if !c.online() {
+			continue
+		}
+
+		if c.hasOrder(floor, elevio.BT_HallUp) {
+			calls = append(calls, fmt.Sprintf("^%d", nodeID))
+		}
+
+		if c.hasOrder(floor, elevio.BT_HallDown) {
+			calls = append(calls, fmt.Sprintf("v%d", nodeID))
+		}
+	}
+
+	return strings.Join(calls, " ")
+}
+
+func (c *car) cell(floor int) string {
+	cabCall := ""
+
+	if c.hasOrder(floor, elevio.BT_Cab) {
+		cabCall = " *"
+	}
+
+	if !c.online() || c.status.Floor != floor {
+		return "   " + cabCall
+	}
+
+	switch {
+	case c.status.Stuck:
+		return "[X]" + cabCall
+	case c.status.DoorObstr:
+		return "[!]" + cabCall
+	case c.status.Behaviour == types.EB_DoorOpen:
+		return "]=[" + cabCall
+	case c.status.Dirn == elevio.MD_Up:
+		return "[^]" + cabCall
+	case c.status.Dirn == elevio.MD_Down:
+		return "[v]" + cabCall
+	}
+
+	return "[ ]" + cabCall
+}
+
+func (c *car) describe() string {
+	if !c.online() {
+		return fmt.Sprintf("Car %d: offline, last seen %s ago",
+			c.status.NodeID,
+			time.Since(c.lastSeen).Round(time.Second),
+		)
+	}
+
+	directions := map[elevio.MotorDirection]string{
+		elevio.MD_Up:   "up",
+		elevio.MD_Down: "down",
+		elevio.MD_Stop: "stopped",
+	}
+
+	door := "closed"
+
+	if c.status.Behaviour == types.EB_DoorOpen {
+		door = "open"
+	}
+
+	service := "in service"
+
+	if c.status.FireService {
+		service = "fire service"
+	} else if c.status.FireRecall {
+		service = "fire recall"
+	} else if c.status.OutOfService {
+		service = "out of service"
+	} else if c.status.Independent {
+		service = "independent"
+	} else if c.status.PoweredDown {
+		service = "powered down"
+	} else if c.status.ParkingFloor >= 0 {
+		service = fmt.Sprintf("parked at %d", c.status.ParkingFloor)
+	}
+
+	return fmt.Sprintf("Car %d: floor %d | %-7s | door %-6s | obstructed %-5t | stuck %-5t | load %3d%% | %s | %d orders",
+		c.status.NodeID,
+		c.status.Floor,
+		directions[c.status.Dirn],
+		door,
+		c.status.DoorObstr,
+		c.status.Stuck,
+		c.status.Load,
+		service,
+		len(c.status.Orders),
+	)
+}
+
+/*
+ * Follows the next node of each online car, starting from the lowest ID
+ */
+func (d *dashboard) ring() string {
+	var start *car
+
+	for _, nodeID := range d.nodeIDs() {
+		if d.cars[nodeID].online() {
+			start = d.cars[nodeID]
+			break
+		}
+	}
+
+	if start == nil {
+		return "no cars online"
+	}
+
+	path := []string{fmt.Sprint(start.status.NodeID)}
+	visited := map[int]bool{start.status.NodeID: true}
+	current := start
+
+	for {
+		nextNodeID := current.status.NextNodeID
+
+		if 0 > nextNodeID {
+			return strings.Join(path, " -> ") + " (disconnected)"
+		}
+
+		path = append(path, fmt.Sprint(nextNodeID))
+
+		if visited[nextNodeID] {
+			return strings.Join(path, " -> ")
+		}
+
+		next, exists := d.cars[nextNodeID]
+
+		if !exists || !next.online() {
+			return strings.Join(path, " -> ") + " (offline)"
+		}
+
+		visited[nextNodeID] = true
+		current = next
+	}
+}
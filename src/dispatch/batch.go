@@ -0,0 +1,307 @@
+package dispatch
+
+import (
+	"Driver-go/elevio"
+	"elevator/fsm"
+	"elevator/orders"
+	"elevator/types"
+	"slices"
+)
+
+/*
+ * Above this number of possible assignments the hall orders
+ * are assigned greedily, oldest order first
+ */
+const EXHAUSTIVE_LIMIT = 4096
+
+/*
+ * Cost of an assignment the car can not serve
+ */
+const UNREACHABLE = 1 << 40
+
+/*
+ * Assigns every unserved hall order to one of the available cars,
+ * minimising the sum of the times until each order of every car is served.
+ * Orders at floors no available car serves are left with their car.
+ * The current assignment is kept unless a strictly better one is found.
+ * Hall orders given to a car on an express run cost EXPRESS_PENALTY each,
+ * and hall orders given to a loaded car cost its load penalty each.
+ *
+ * Returns the assignee of each hall order indexed by order ID.
+ */
+func BatchAssign(
+	cars []types.CarState,
+	registry types.OrderRegistry,
+	elevConfig *types.ElevConfig,
+	mode types.TrafficMode,
+) map[string]int {
+
+	assignments := make(map[string]int)
+
+	available := availableCars(cars)
+	hallOrders := slices.DeleteFunc(hallOrdersToAssign(registry), func(order types.Order) bool {
+		return !slices.ContainsFunc(available, func(car types.CarState) bool {
+			return orders.Serves(car.ServedFloors, order.Floor)
+		})
+	})
+
+	if len(available) == 0 || len(hallOrders) == 0 {
+		return assignments
+	}
+
+	b := batch{
+		cars:       available,
+		hallOrders: hallOrders,
+		cabOrders:  make([][]types.Order, len(available)),
+		elevConfig: elevConfig,
+		mode:       mode,
+	}
+
+	for car := range available {
+		for _, order := range orders.AssignedTo(registry, available[car].NodeID) {
+			if order.Button == elevio.BT_Cab {
+				b.cabOrders[car] = append(b.cabOrders[car], order)
+			}
+		}
+	}
+
+	bestChoice, currentValid := b.currentChoice()
+
+	var choice []int
+
+	if numChoices(len(available), len(hallOrders)) <= EXHAUSTIVE_LIMIT {
+		choice = b.exhaustiveChoice()
+	} else {
+		choice = b.greedyChoice()
+	}
+
+	if !currentValid || b.totalCost(choice) < b.totalCost(bestChoice) {
+		bestChoice = choice
+	}
+
+	for i, order := range hallOrders {
+		if b.carCost(bestChoice[i], []types.Order{order}) == UNREACHABLE {
+			continue
+		}
+
+		assignments[order.ID] = available[bestChoice[i]].NodeID
+	}
+
+	return assignments
+}
+
+/*
+ * A choice holds the index of the car each of the hall orders is assigned to
+ */
+type batch struct {
+	cars       []types.CarState
+	hallOrders []types.Order
+	cabOrders  [][]types.Order
+	elevConfig *types.ElevConfig
+	mode       types.TrafficMode
+}
+
+func (b *batch) currentChoice() ([]int, bool) {
+	choice := make([]int, len(b.hallOrders))
+	valid := true
+
+	for i, order := range b.hallOrders {
+		choice[i] = slices.IndexFunc(b.cars, func(car types.CarState) bool {
+			return car.NodeID == order.Assignee
+		})
+
+		if 0 > choice[i] {
+			choice[i] = 0
+			valid = false
+		}
+	}
+
+	return choice, valid
+}
+
+func (b *batch) carCost(car int, hallOrders []types.Order) int {
+	carOrders := append(slices.Clone(b.cabOrders[car]), hallOrders...)
+
+	if len(carOrders) == 0 {
+		return 0
+	}
+
+	for _, order := range hallOrders {
+		if !orders.Serves(b.cars[car].ServedFloors, order.Floor) {
+			return UNREACHABLE
+		}
+	}
+
+	timeToServed := fsm.TimeToAllOrdersServed(b.cars[car], carOrders, b.elevConfig)
+
+	if 0 > timeToServed {
+		return UNREACHABLE
+	}
+
+	if expressRun(b.mode, b.cars[car].Floor, b.cabOrders[car]) {
+		timeToServed += len(hallOrders) * EXPRESS_PENALTY
+	}
+
+	capacity := b.cars[car].Capacity
+
+	if capacity <= 0 {
+		capacity = b.elevConfig.Capacity
+	}
+
+	timeToServed += len(hallOrders) * loadPenalty(b.cars[car].Load, capacity)
+
+	return timeToServed
+}
+
+func (b *batch) totalCost(choice []int) int {
+	total := 0
+
+	for car := range b.cars {
+		total += b.carCost(car, b.ordersOf(car, choice))
+	}
+
+	return total
+}
+
+func (b *batch) ordersOf(car int, choice []int) []types.Order {
+	var carOrders []types.Order
+
+	for i, assignedCar := range choice {
+		if assignedCar == car {
+			carOrders = append(carOrders, b.hallOrders[i])
+		}
+	}
+
+	return carOrders
+}
+
+/*
+ * Tries every assignment, the cost of each car and set of orders is only simulated once
+ */
+func (b *batch) exhaustiveChoice() []int {
+	memo := make([]map[uint64]int, len(b.cars))
+
+	for car := range memo {
+		memo[car] = make(map[uint64]int)
+	}
+
+	choice := make([]int, len(b.hallOrders))
+	bestChoice := slices.Clone(choice)
+	bestCost := -1
+
+	for {
+		cost := 0
+
+		for car := range b.cars {
+			var mask uint64
+
+			for i, assignedCar := range choice {
+				if assignedCar == car {
+					mask |= 1 << i
+				}
+			}
+
+			carCost, exists := memo[car][mask]
+
+			if !exists {
+				carCost = b.carCost(car, b.ordersOf(car, choice))
+				memo[car][mask] = carCost
+			}
+
+			cost += carCost
+		}
+
+		if 0 > bestCost || cost < bestCost {
+			bestCost = cost
+			copy(bestChoice, choice)
+		}
+
+		/*
+		 * Count to the next assignment, with one digit per order
+		 */
+		i := 0
+
+		for ; i < len(choice); i++ {
+			choice[i]++
+
+			if choice[i] < len(b.cars) {
+				break
+			}
+
+			choice[i] = 0
+		}
+
+		if i == len(choice) {
+			return bestChoice
+		}
+	}
+}
+
+/*
+ * Gives each order, oldest first, to the car whose cost increases the least
+ */
+func (b *batch) greedyChoice() []int {
+	choice := make([]int, len(b.hallOrders))
+	carOrders := make([][]types.Order, len(b.cars))
+
+	for i, order := range b.hallOrders {
+		bestIncrease := -1
+
+		for car := range b.cars {
+			withOrder := append(slices.Clone(carOrders[car]), order)
+			increase := b.carCost(car, withOrder) - b.carCost(car, carOrders[car])
+
+			if 0 > bestIncrease || increase < bestIncrease {
+				bestIncrease = increase
+				choice[i] = car
+			}
+		}
+
+		carOrders[choice[i]] = append(carOrders[choice[i]], order)
+	}
+
+	return choice
+}
+
+func availableCars(cars []types.CarState) []types.CarState {
+	var available []types.CarState
+
+	for _, car := range cars {
+		if car.Available && 0 <= car.Floor {
+			available = append(available, car)
+		}
+	}
+
+	return available
+}
+
+/*
+ * Hall orders being served are left with their car
+ */
+func hallOrdersToAssign(registry types.OrderRegistry) []types.Order {
+	var hallOrders []types.Order
+
+	for _, order := range registry {
+		if order.State == types.OS_Assigned && order.Button != elevio.BT_Cab {
+			hallOrders = append(hallOrders, order)
+		}
+	}
+
+	orders.SortOldestFirst(hallOrders)
+
+	return hallOrders
+}
+
+func numChoices(numCars int, numOrders int) int {
+	choices := 1
+
+	for i := 0; i < numOrders; i++ {
+		choices *= numCars
+
+		if choices > EXHAUSTIVE_LIMIT {
+			return choices
+		}
+	}
+
+	return choices
+}
@@ -0,0 +1,210 @@
+package dispatch
+
+import (
+	"Driver-go/elevio"
+	"elevator/types"
+	"testing"
+)
+
+var batchConfig = &types.ElevConfig{
+	NumNodes:         3,
+	NumFloors:        4,
+	NumButtons:       3,
+	DoorOpenDuration: 3000,
+	TravelTime:       2000,
+}
+
+func idleCar(node int, floor int) types.CarState {
+	return types.CarState{
+		NodeID:    node,
+		Floor:     floor,
+		Dirn:      elevio.MD_Stop,
+		Behaviour: types.EB_Idle,
+		Available: true,
+	}
+}
+
+func hallOrders(calls ...elevio.ButtonEvent) types.OrderRegistry {
+	registry := make(types.OrderRegistry)
+
+	for i, call := range calls {
+		order := assigned(call.Floor, call.Button, int(types.UNASSIGNED))
+		order.ID = string(rune('a' + i))
+		order.CreatedAt = int64(i)
+		registry[order.ID] = order
+	}
+
+	return registry
+}
+
+func newBatch(cars []types.CarState, registry types.OrderRegistry) *batch {
+	return &batch{
+		cars:       cars,
+		hallOrders: hallOrdersToAssign(registry),
+		cabOrders:  make([][]types.Order, len(cars)),
+		elevConfig: batchConfig,
+	}
+}
+
+func TestBatchAssignIdleCars(t *testing.T) {
+	cars := []types.CarState{idleCar(0, 0), idleCar(1, 3)}
+
+	registry := hallOrders(
+		elevio.ButtonEvent{Floor: 0, Button: elevio.BT_HallUp},
+		elevio.ButtonEvent{Floor: 3, Button: elevio.BT_HallDown},
+	)
+
+	assignments := BatchAssign(cars, registry, batchConfig, types.TM_Normal)
+
+	if assignments["a"] != 0 || assignments["b"] != 1 {
+		t.Errorf("got %v, want each order given to the car at its floor", assignments)
+	}
+}
+
+func TestBatchAssignKeepsCurrentAssignment(t *testing.T) {
+	cars := []types.CarState{idleCar(0, 1), idleCar(1, 1)}
+
+	registry := hallOrders(elevio.ButtonEvent{Floor: 3, Button: elevio.BT_HallDown})
+
+	order := registry["a"]
+	order.Assignee = 1
+	registry["a"] = order
+
+	assignments := BatchAssign(cars, registry, batchConfig, types.TM_Normal)
+
+	if assignments["a"] != 1 {
+		t.Errorf("order moved from car 1 to car %d at equal cost", assignments["a"])
+	}
+}
+
+func TestBatchAssignSkipsUnavailableCars(t *testing.T) {
+	unavailable := idleCar(0, 3)
+	unavailable.Available = false
+
+	cars := []types.CarState{unavailable, idleCar(1, 0), {NodeID: 2, Floor: -1, Available: true}}
+
+	registry := hallOrders(elevio.ButtonEvent{Floor: 3, Button: elevio.BT_HallDown})
+
+	assignments := BatchAssign(cars, registry, batchConfig, types.TM_Normal)
+
+	if assignments["a"] != 1 {
+		t.Errorf("got assignee %d, want the only available car 1", assignments["a"])
+	}
+}
+
+func TestBatchAssignUnreachable(t *testing.T) {
+	lowRise := idleCar(0, 0)
+	lowRise.ServedFloors = []bool{true, true, false, false}
+
+	registry := hallOrders(
+		elevio.ButtonEvent{Floor: 1, Button: elevio.BT_HallUp},
+		elevio.ButtonEvent{Floor: 3, Button: elevio.BT_HallDown},
+	)
+
+	assignments := BatchAssign([]types.CarState{lowRise}, registry, batchConfig, types.TM_Normal)
+
+	if _, assigned := assignments["b"]; assigned || assignments["a"] != 0 {
+		t.Errorf("got %v, want only the order at floor 1 given to car 0", assignments)
+	}
+
+	assignments = BatchAssign([]types.CarState{lowRise, idleCar(1, 0)}, registry, batchConfig, types.TM_Normal)
+
+	if assignments["b"] != 1 {
+		t.Errorf("order at floor 3 given to car %d, want the car which serves it", assignments["b"])
+	}
+}
+
+func TestBatchAssignTallerCar(t *testing.T) {
+	short := idleCar(0, 3)
+	short.NumFloors = 4
+	short.ServedFloors = []bool{true, true, true, true}
+
+	tall := idleCar(1, 0)
+	tall.NumFloors = 6
+	tall.ServedFloors = []bool{true, true, true, true, true, true}
+
+	registry := hallOrders(elevio.ButtonEvent{Floor: 5, Button: elevio.BT_HallDown})
+
+	assignments := BatchAssign([]types.CarState{short, tall}, registry, batchConfig, types.TM_Normal)
+
+	if assignments["a"] != 1 {
+		t.Errorf("order above the shaft of the coordinator given to car %d, want the taller car 1", assignments["a"])
+	}
+}
+
+/*
+ * The greedy choice can not beat the exhaustive one,
+ * and finds the same assignment when the orders do not interact
+ */
+func TestExhaustiveAndGreedyChoice(t *testing.T) {
+	tests := []struct {
+		name  string
+		cars  []types.CarState
+		calls []elevio.ButtonEvent
+	}{
+		{
+			name: "one order per car",
+			cars: []types.CarState{idleCar(0, 0), idleCar(1, 3)},
+			calls: []elevio.ButtonEvent{
+				{Floor: 0, Button: elevio.BT_HallUp},
+				{Floor: 3, Button: elevio.BT_HallDown},
+			},
+		},
+		{
+			name: "orders in one shaft",
+			cars: []types.CarState{idleCar(0, 0), idleCar(1, 2), idleCar(2, 3)},
+			calls: []elevio.ButtonEvent{
+				{Floor: 1, Button: elevio.BT_HallUp},
+				{Floor: 2, Button: elevio.BT_HallUp},
+				{Floor: 3, Button: elevio.BT_HallDown},
+				{Floor: 1, Button: elevio.BT_HallDown},
+				{Floor: 0, Button: elevio.BT_HallUp},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newBatch(test.cars, hallOrders(test.calls...))
+
+			exhaustive := b.exhaustiveChoice()
+			greedy := b.greedyChoice()
+
+			if b.totalCost(greedy) < b.totalCost(exhaustive) {
+				t.Errorf("greedy choice %v costs %d, less than exhaustive choice %v at %d",
+					greedy, b.totalCost(greedy), exhaustive, b.totalCost(exhaustive))
+			}
+
+			if len(test.calls) <= len(test.cars) && b.totalCost(greedy) != b.totalCost(exhaustive) {
+				t.Errorf("greedy choice %v costs %d, exhaustive choice %v costs %d",
+					greedy, b.totalCost(greedy), exhaustive, b.totalCost(exhaustive))
+			}
+		})
+	}
+}
+
+func TestGreedyAboveExhaustiveLimit(t *testing.T) {
+	elevConfig := *batchConfig
+	elevConfig.NumFloors = 6
+
+	cars := []types.CarState{idleCar(0, 0), idleCar(1, 1), idleCar(2, 4), idleCar(3, 5)}
+
+	var calls []elevio.ButtonEvent
+
+	for floor := 0; floor < elevConfig.NumFloors-1; floor++ {
+		calls = append(calls,
+			elevio.ButtonEvent{Floor: floor, Button: elevio.BT_HallUp},
+			elevio.ButtonEvent{Floor: floor + 1, Button: elevio.BT_HallDown},
+		)
+	}
+
+	if numChoices(len(cars), len(calls)) <= EXHAUSTIVE_LIMIT {
+		t.Fatalf("%d choices, want more than EXHAUSTIVE_LIMIT", numChoices(len(cars), len(calls)))
+	}
+
+	assignments := BatchAssign(cars, hallOrders(calls...), &elevConfig, types.TM_Normal)
+
+	if len(assignments) != len(calls) {
+		t.Errorf("got %d assignments, want %d", len(assignments), len(calls))
+	}
+}
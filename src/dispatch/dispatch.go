@@ -0,0 +1,197 @@
+package dispatch
+
+import (
+	"Driver-go/elevio"
+	"elevator/fsm"
+	"elevator/orders"
+	"elevator/types"
+	"slices"
+)
+
+/*
+ * A dispatcher decides which node an order is assigned to:
+ * - Every node fills in its own cost of serving the order in the bid
+ * - The author of the bid chooses the assignee when the bid returns
+ *
+ * A cost of -1 means the node can not serve the order,
+ * and Choose returns -1 if no node can serve it.
+ * All nodes should use the same dispatcher, otherwise the costs are not comparable.
+ */
+type Dispatcher interface {
+	Cost(elevState *types.ElevState, elevConfig *types.ElevConfig, order types.Order) int
+	Choose(costs []int) int
+}
+
+const DEFAULT = "simulated"
+
+/*
+ * In up-peak a car carrying passengers up runs express to their floors,
+ * so hall calls on the way are left to the other cars
+ */
+const EXPRESS_PENALTY = 30000 // ms
+
+/*
+ * A car with fewer than MIN_ROOM free places may have no room left
+ * when it arrives, so hall calls cost it up to LOAD_PENALTY extra,
+ * growing as the room left shrinks
+ */
+const MIN_ROOM = 4         // passengers
+const LOAD_PENALTY = 30000 // ms
+
+var strategies = map[string]Dispatcher{
+	"simulated": SimulatedTime{},
+	"nearest":   NearestCar{},
+	"leastbusy": LeastBusy{},
+}
+
+/*
+ * Returns the dispatcher with the given name, and false if there is none
+ */
+func New(name string) (Dispatcher, bool) {
+	dispatcher, exists := strategies[name]
+	return dispatcher, exists
+}
+
+func Names() []string {
+	names := make([]string, 0, len(strategies))
+
+	for name := range strategies {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+/*
+ * Simulates the car serving its orders until the new order is served
+ */
+type SimulatedTime struct{}
+
+func (SimulatedTime) Cost(elevState *types.ElevState, elevConfig *types.ElevConfig, order types.Order) int {
+	cost := fsm.TimeToOrderServed(elevState, elevConfig, order)
+
+	return withPenalties(cost, elevState, elevConfig, order)
+}
+
+func (SimulatedTime) Choose(costs []int) int {
+	return lowestCost(costs)
+}
+
+/*
+ * Travel time to the floor of the order at the speed of the car, ignoring other orders
+ */
+type NearestCar struct{}
+
+func (NearestCar) Cost(elevState *types.ElevState, elevConfig *types.ElevConfig, order types.Order) int {
+	if 0 > elevState.Floor {
+		return -1
+	}
+
+	distance := order.Floor - elevState.Floor
+
+	if 0 > distance {
+		distance = -distance
+	}
+
+	return withPenalties(distance*elevConfig.TravelTime, elevState, elevConfig, order)
+}
+
+func (NearestCar) Choose(costs []int) int {
+	return lowestCost(costs)
+}
+
+/*
+ * Number of orders the car already has, with travel time as tie breaker
+ */
+type LeastBusy struct{}
+
+const BUSY_PENALTY = 60000 // ms
+
+func (LeastBusy) Cost(elevState *types.ElevState, elevConfig *types.ElevConfig, order types.Order) int {
+	travelTime := NearestCar{}.Cost(elevState, elevConfig, order)
+
+	if 0 > travelTime {
+		return -1
+	}
+
+	numOrders := len(orders.AssignedTo(elevState.Orders, elevConfig.NodeID))
+
+	return numOrders*BUSY_PENALTY + travelTime
+}
+
+func (LeastBusy) Choose(costs []int) int {
+	return lowestCost(costs)
+}
+
+func withPenalties(
+	cost int,
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	order types.Order,
+) int {
+
+	if 0 > cost || order.Button == elevio.BT_Cab {
+		return cost
+	}
+
+	cost += loadPenalty(elevState.Load, elevConfig.Capacity)
+
+	carOrders := orders.AssignedTo(elevState.Orders, elevConfig.NodeID)
+
+	if expressRun(elevState.TrafficMode, elevState.Floor, carOrders) {
+		return cost + EXPRESS_PENALTY
+	}
+
+	return cost
+}
+
+/*
+ * The load is in percent of the capacity of the car in passengers,
+ * a car of unknown capacity is given no penalty
+ */
+func loadPenalty(load int, capacity int) int {
+	if capacity <= 0 {
+		return 0
+	}
+
+	room := capacity * (100 - min(load, 100)) / 100
+
+	if room >= MIN_ROOM {
+		return 0
+	}
+
+	return LOAD_PENALTY * (MIN_ROOM - max(room, 0)) / MIN_ROOM
+}
+
+/*
+ * Whether the car has passengers going up during up-peak
+ */
+func expressRun(mode types.TrafficMode, floor int, carOrders []types.Order) bool {
+	if mode != types.TM_UpPeak {
+		return false
+	}
+
+	return slices.ContainsFunc(carOrders, func(order types.Order) bool {
+		return order.Button == elevio.BT_Cab && order.Floor > floor
+	})
+}
+
+/*
+ * Find the index of the lowest value that is not -1,
+ * or -1 if every value is -1
+ */
+func lowestCost(costs []int) int {
+	result := -1
+
+	for i, value := range costs {
+		if 0 > value {
+			continue
+		} else if 0 > result || value < costs[result] {
+			result = i
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,175 @@
+package dispatch
+
+import (
+	"Driver-go/elevio"
+	"elevator/orders"
+	"elevator/types"
+	"testing"
+)
+
+func TestLowestCost(t *testing.T) {
+	tests := []struct {
+		name  string
+		costs []int
+		want  int
+	}{
+		{"single node", []int{4000}, 0},
+		{"lowest wins", []int{8000, 2000, 6000}, 1},
+		{"tie goes to lowest node ID", []int{6000, 2000, 2000}, 1},
+		{"node which can not serve is skipped", []int{-1, 6000, 4000}, 2},
+		{"zero cost wins", []int{3000, 0, -1}, 1},
+		{"no node can serve", []int{-1, -1, -1}, -1},
+		{"no nodes", []int{}, -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := lowestCost(test.costs)
+
+			if got != test.want {
+				t.Errorf("lowestCost(%v) = %d, want %d", test.costs, got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadPenalty(t *testing.T) {
+	tests := []struct {
+		name     string
+		load     int
+		capacity int
+		want     int
+	}{
+		{"empty car", 0, 8, 0},
+		{"room for MIN_ROOM passengers", 50, 8, 0},
+		{"room for two passengers", 75, 8, LOAD_PENALTY / 2},
+		{"same load in a larger car", 75, 16, 0},
+		{"small car", 0, 2, LOAD_PENALTY / 2},
+		{"overloaded car", 120, 8, LOAD_PENALTY},
+		{"unknown capacity", 90, 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := loadPenalty(test.load, test.capacity)
+
+			if got != test.want {
+				t.Errorf("loadPenalty(%d, %d) = %d, want %d", test.load, test.capacity, got, test.want)
+			}
+		})
+	}
+}
+
+/*
+ * Cars of a ring, each at its floor and with its assigned orders
+ */
+type scenario struct {
+	name   string
+	floors []int
+	dirns  []elevio.MotorDirection
+	orders []types.Order
+	order  types.Order
+	want   map[string]int
+}
+
+func assigned(floor int, button elevio.ButtonType, assignee int) types.Order {
+	order := orders.New(elevio.ButtonEvent{Floor: floor, Button: button}, assignee)
+	order.ID = order.ID + "-" + string(rune('a'+floor)) + string(rune('a'+int(button)))
+	order.Assignee = assignee
+	order.State = types.OS_Assigned
+
+	return order
+}
+
+var scenarios = []scenario{
+	{
+		name:   "idle car at the floor",
+		floors: []int{0, 1, 3},
+		order:  assigned(3, elevio.BT_HallDown, int(types.UNASSIGNED)),
+		want: map[string]int{
+			"simulated": 2,
+			"nearest":   2,
+			"leastbusy": 2,
+		},
+	},
+	{
+		name:   "car without a floor can not serve",
+		floors: []int{-1, 0},
+		order:  assigned(3, elevio.BT_HallDown, int(types.UNASSIGNED)),
+		want: map[string]int{
+			"simulated": 1,
+			"nearest":   1,
+			"leastbusy": 1,
+		},
+	},
+	{
+		name:   "no car can serve",
+		floors: []int{-1, -1},
+		order:  assigned(3, elevio.BT_HallDown, int(types.UNASSIGNED)),
+		want: map[string]int{
+			"simulated": -1,
+			"nearest":   -1,
+			"leastbusy": -1,
+		},
+	},
+	{
+		name:   "nearest car is busy",
+		floors: []int{1, 0},
+		dirns:  []elevio.MotorDirection{elevio.MD_Down, elevio.MD_Stop},
+		orders: []types.Order{
+			assigned(0, elevio.BT_Cab, 0),
+			assigned(3, elevio.BT_HallDown, 0),
+		},
+		order: assigned(2, elevio.BT_HallUp, int(types.UNASSIGNED)),
+		want: map[string]int{
+			"simulated": 1,
+			"nearest":   0,
+			"leastbusy": 1,
+		},
+	},
+}
+
+func TestChoose(t *testing.T) {
+	for _, name := range Names() {
+		dispatcher, _ := New(name)
+
+		for _, scenario := range scenarios {
+			t.Run(name+"/"+scenario.name, func(t *testing.T) {
+				costs := make([]int, len(scenario.floors))
+
+				for node, floor := range scenario.floors {
+					elevConfig := &types.ElevConfig{
+						NodeID:           node,
+						NumNodes:         len(scenario.floors),
+						NumFloors:        4,
+						NumButtons:       3,
+						DoorOpenDuration: 3000,
+						TravelTime:       2000,
+					}
+
+					elevState := &types.ElevState{
+						Floor:  floor,
+						Dirn:   elevio.MD_Stop,
+						Orders: make(types.OrderRegistry),
+					}
+
+					if scenario.dirns != nil {
+						elevState.Dirn = scenario.dirns[node]
+					}
+
+					for _, order := range scenario.orders {
+						elevState.Orders[order.ID] = order
+					}
+
+					costs[node] = dispatcher.Cost(elevState, elevConfig, scenario.order)
+				}
+
+				got := dispatcher.Choose(costs)
+
+				if got != scenario.want[name] {
+					t.Errorf("chose node %d with costs %v, want node %d", got, costs, scenario.want[name])
+				}
+			})
+		}
+	}
+}
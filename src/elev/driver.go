@@ -0,0 +1,48 @@
+package elev
+
+import "Driver-go/elevio"
+
+/*
+ * Outputs to the elevator, and the floor sensor read at startup.
+ * A journal replay swaps the hardware for a recorder.
+ */
+type Driver interface {
+	SetMotorDirection(dirn elevio.MotorDirection)
+	SetButtonLamp(button elevio.ButtonType, floor int, value bool)
+	SetFloorIndicator(floor int)
+	SetDoorOpenLamp(value bool)
+	SetStopLamp(value bool)
+	GetFloor() int
+}
+
+type hardware struct{}
+
+func (hardware) SetMotorDirection(dirn elevio.MotorDirection) {
+	elevio.SetMotorDirection(dirn)
+}
+
+func (hardware) SetButtonLamp(button elevio.ButtonType, floor int, value bool) {
+	elevio.SetButtonLamp(button, floor, value)
+}
+
+func (hardware) SetFloorIndicator(floor int) {
+	elevio.SetFloorIndicator(floor)
+}
+
+func (hardware) SetDoorOpenLamp(value bool) {
+	elevio.SetDoorOpenLamp(value)
+}
+
+func (hardware) SetStopLamp(value bool) {
+	elevio.SetStopLamp(value)
+}
+
+func (hardware) GetFloor() int {
+	return elevio.GetFloor()
+}
+
+var Drv Driver = hardware{}
+
+func SetDriver(driver Driver) {
+	Drv = driver
+}
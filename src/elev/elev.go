@@ -2,19 +2,55 @@ package elev
 
 import (
 	"Driver-go/elevio"
+	"elevator/calib"
+	"elevator/clock"
+	"elevator/events"
+	"elevator/metrics"
 	"elevator/network"
+	"elevator/orders"
 	"elevator/types"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"slices"
 	"strconv"
+	"time"
 )
 
+const BLINK_COUNT = 4
+const BLINK_PERIOD = 500 // ms
+
+const DOOR_CLOSE_POLL_RATE = 20 // ms
+
+const LOAD_POLL_RATE = 20 // ms
+
+/*
+ * A server without a load sensor never answers
+ */
+const LOAD_TIMEOUT = 500 // ms
+
+/*
+ * The connection to the load sensor is retried after this delay,
+ * doubled after every failed attempt up to LOAD_MAX_RETRY_DELAY
+ */
+const LOAD_RETRY_DELAY = 1000 // ms
+
+const LOAD_MAX_RETRY_DELAY = 30000 // ms
+
+/*
+ * Load from which the car takes no more passengers
+ */
+const FULL_LOAD = 80 // percent
+
 func InitConfig(
 	nodeID int,
 	numNodes int,
 	numFloors int,
 	numButtons int,
 	doorOpenDuration int,
+	travelTime int,
 ) *types.ElevConfig {
 
 	if nodeID+1 > numNodes {
@@ -27,26 +63,20 @@ func InitConfig(
 		NumFloors:        numFloors,
 		NumButtons:       numButtons,
 		DoorOpenDuration: doorOpenDuration,
+		TravelTime:       travelTime,
 	}
 
 	return &elevator
 }
 
 func InitState(elevConfig *types.ElevConfig) *types.ElevState {
-	orders := make([][][]bool, elevConfig.NumNodes)
-
-	for elevator := range orders {
-		orders[elevator] = make([][]bool, elevConfig.NumFloors)
-		for floor := range orders[elevator] {
-			orders[elevator][floor] = make([]bool, elevConfig.NumButtons)
-		}
-	}
-
 	elevState := types.ElevState{
 		Floor:      -1,
 		Dirn:       elevio.MD_Stop,
-		Orders:     orders,
+		Orders:     make(types.OrderRegistry),
 		NextNodeID: -1,
+
+		ParkingFloor: -1,
 	}
 
 	return &elevState
@@ -71,16 +101,159 @@ func InitDriver(
 	go elevio.PollFloorSensor(drvFloors)
 	go elevio.PollObstructionSwitch(drvObstr)
 
-	/*
-	 * Reset elevator to known state
-	 */
-	elevio.SetDoorOpenLamp(false)
-	SetCabLights(elevState.Orders[elevConfig.NodeID], elevConfig)
-	SetHallLights(elevState.Orders, elevConfig)
+	ResetOutputs(elevState, elevConfig)
 
 	return drvButtons, drvFloors, drvObstr
 }
 
+/*
+ * The simulator has no door close button,
+ * so the door close input is held while any cab button is held.
+ * Only polled during fire service, until stop is closed.
+ */
+func PollDoorClose(receiver chan<- bool, numFloors int, stop <-chan bool) {
+	held := false
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(DOOR_CLOSE_POLL_RATE * time.Millisecond):
+		}
+
+		anyHeld := false
+
+		for floor := 0; floor < numFloors; floor++ {
+			anyHeld = anyHeld || elevio.GetButton(elevio.BT_Cab, floor)
+		}
+
+		if anyHeld != held {
+			held = anyHeld
+			receiver <- held
+		}
+	}
+}
+
+/*
+ * Reads the load of the car from an elevator server with a load sensor,
+ * which answers command 10 with the load in percent of the rated load.
+ * The sensor is read on a connection of its own with a deadline,
+ * so a server that does not answer never holds up the driver.
+ * While the sensor can not be read the car is taken as empty,
+ * so it is never left bypassing hall calls at full load.
+ */
+func PollLoad(addr string, receiver chan<- int) {
+	load := 0
+	retryDelay := LOAD_RETRY_DELAY
+
+	for {
+		err := readLoad(addr, receiver, &load, &retryDelay)
+
+		slog.Error("Could not read the load sensor, trying again",
+			"addr", addr,
+			"err", err,
+			"retryIn", retryDelay,
+		)
+
+		if load != 0 {
+			load = 0
+			receiver <- load
+		}
+
+		time.Sleep(time.Duration(retryDelay) * time.Millisecond)
+		retryDelay = min(2*retryDelay, LOAD_MAX_RETRY_DELAY)
+	}
+}
+
+/*
+ * Reads the load sensor until it fails to answer
+ */
+func readLoad(addr string, receiver chan<- int, load *int, retryDelay *int) error {
+	conn, err := net.DialTimeout("tcp", addr, LOAD_TIMEOUT*time.Millisecond)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	for {
+		time.Sleep(LOAD_POLL_RATE * time.Millisecond)
+
+		var reply [4]byte
+
+		conn.SetDeadline(time.Now().Add(LOAD_TIMEOUT * time.Millisecond))
+
+		_, err := conn.Write([]byte{10, 0, 0, 0})
+
+		if err == nil {
+			_, err = io.ReadFull(conn, reply[:])
+		}
+
+		if err != nil {
+			return err
+		}
+
+		*retryDelay = LOAD_RETRY_DELAY
+
+		if int(reply[1]) != *load {
+			*load = int(reply[1])
+			receiver <- *load
+		}
+	}
+}
+
+/*
+ * Reset elevator to known state
+ */
+func ResetOutputs(elevState *types.ElevState, elevConfig *types.ElevConfig) {
+	Drv.SetDoorOpenLamp(false)
+	Drv.SetStopLamp(elevState.OutOfService)
+	SetCabLights(elevState.Orders, elevConfig)
+	SetHallLights(elevState.Orders, elevConfig)
+}
+
+/*
+ * Passes button presses injected for this node on as if they came from the driver
+ */
+func ForwardInjectedButtons(
+	elevConfig *types.ElevConfig,
+	injected <-chan types.InjectedButton,
+	drvButtons chan<- elevio.ButtonEvent,
+) {
+
+	for injection := range injected {
+		if injection.NodeID != elevConfig.NodeID {
+			continue
+		}
+
+		if 0 > injection.Button.Floor || injection.Button.Floor >= elevConfig.NumFloors {
+			continue
+		}
+
+		drvButtons <- injection.Button
+	}
+}
+
+/*
+ * The traffic generator counts the passengers in each car,
+ * which are turned into a load in percent of the capacity of the car
+ */
+func ForwardInjectedLoads(
+	elevConfig *types.ElevConfig,
+	injected <-chan types.InjectedLoad,
+	drvLoad chan<- int,
+) {
+
+	for injection := range injected {
+		if injection.NodeID != elevConfig.NodeID {
+			continue
+		}
+
+		drvLoad <- injection.Passengers * 100 / elevConfig.Capacity
+	}
+}
+
 func SetState(
 	elevState *types.ElevState,
 	elevConfig *types.ElevConfig,
@@ -89,17 +262,53 @@ func SetState(
 
 	doorTimer chan<- types.TimerActions,
 	floorTimer chan<- types.TimerActions,
+
+	travelModel *calib.Model,
 ) *types.ElevState {
 
 	if stateChanges.SetMotor {
-		elevio.SetMotorDirection(stateChanges.MotorDirn)
+		Drv.SetMotorDirection(stateChanges.MotorDirn)
 
 		if stateChanges.MotorDirn != elevio.MD_Stop {
 			floorTimer <- types.START
+			travelModel.OnDeparture()
 		}
 	}
 
-	elevio.SetDoorOpenLamp(stateChanges.Door)
+	Drv.SetDoorOpenLamp(stateChanges.Door)
+
+	metrics.Direction.Set(int64(stateChanges.ElevDirn))
+
+	if stateChanges.Door && !elevState.DoorOpen {
+		events.Publish(events.EV_DoorOpened, elevState.Floor)
+		slog.Debug("Door opened", "floor", elevState.Floor)
+	} else if !stateChanges.Door && elevState.DoorOpen {
+		events.Publish(events.EV_DoorClosed, elevState.Floor)
+		slog.Debug("Door closed", "floor", elevState.Floor)
+	}
+
+	elevState.DoorOpen = stateChanges.Door
+
+	if stateChanges.Door {
+		metrics.DoorOpen.Set(1)
+	} else {
+		metrics.DoorOpen.Set(0)
+	}
+
+	travelModel.OnDoor(stateChanges.Door)
+
+	/*
+	 * The door held open while parked, in independent service,
+	 * in fire service or powered down is not measured as a dwell time
+	 */
+	if elevState.OutOfService ||
+		elevState.IndependentService ||
+		elevState.FireRecall ||
+		elevState.FireService ||
+		elevState.PoweredDown {
+		travelModel.Discard()
+	}
+	elevState.TravelTimes = travelModel.TravelTimes()
 
 	if stateChanges.StartDoorTimer {
 		doorTimer <- types.START
@@ -121,28 +330,28 @@ func ClearOrdersAtFloor(
 	/*
 	 * Clear served orders
 	 */
-	for order, clearOrder := range orderToClearAtFloor{
-		if !clearOrder || !elevState.Orders[elevConfig.NodeID][elevState.Floor][order] {
-			continue
-		}
-
-		order := types.Order{
-			Button: elevio.ButtonType(order),
-			Floor:  elevState.Floor,
-		}
-
+	toClear := orders.ToClearAtFloor(
+		elevState.Orders,
+		elevConfig.NodeID,
+		elevState.Floor,
+		orderToClearAtFloor,
+	)
+
+	for _, order := range toClear {
 		isAlone := elevState.NextNodeID == elevConfig.NodeID
 		disconnected := elevState.NextNodeID == -1
 
+		/*
+		 * An order made while the car is at the floor is reached at once
+		 */
+		order.ArrivedAt = max(elevState.FloorArrivedAt, order.CreatedAt)
+		order.ServedAt = clock.Now().UnixMilli()
+
 		if isAlone || disconnected {
-			elevState = SetOrderStatus(
-				elevState,
-				elevConfig,
-				elevConfig.NodeID,
-				order,
-				false,
-			)
+			elevState = ServeOrder(elevState, elevConfig, order)
 		} else {
+			orders.SetServing(elevState.Orders, order)
+
 			servedTxSecure <- network.FormatServedMsg(
 				order,
 				elevState.NextNodeID,
@@ -154,7 +363,7 @@ func ClearOrdersAtFloor(
 	return elevState
 }
 
-func SetHallLights(orders [][][]bool, elevConfig *types.ElevConfig) {
+func SetHallLights(registry types.OrderRegistry, elevConfig *types.ElevConfig) {
 	// We are here skipping the cab buttons by subtracting 1 from elevConfig.NumButtons.
 	// See type ButtonType in lib/driver-go-master/elevio/elevator_io.go for reference.
 
@@ -164,38 +373,184 @@ func SetHallLights(orders [][][]bool, elevConfig *types.ElevConfig) {
 		combinedOrders[floor] = make([]bool, elevConfig.NumButtons-1)
 	}
 
-	for elevator := range orders {
-		for floor := range orders[elevator] {
-			for orderType := 0; orderType < elevConfig.NumButtons-1; orderType++ {
-				combinedOrders[floor][orderType] = orders[elevator][floor][orderType] || combinedOrders[floor][orderType]
-			}
+	for _, order := range registry {
+		if !orders.IsActive(order) || order.Button == elevio.BT_Cab {
+			continue
+		}
+
+		/*
+		 * Hall calls above the shaft of this car have no lamp here
+		 */
+		if order.Floor >= elevConfig.NumFloors {
+			continue
+		}
+
+		if elevConfig.HallLightGuarantee && !order.Acknowledged {
+			continue
 		}
+
+		combinedOrders[order.Floor][order.Button] = true
 	}
 
 	for floor := range combinedOrders {
 		for orderType := 0; orderType < elevConfig.NumButtons-1; orderType++ {
-			elevio.SetButtonLamp(elevio.ButtonType(orderType), floor, combinedOrders[floor][orderType])
+			Drv.SetButtonLamp(elevio.ButtonType(orderType), floor, combinedOrders[floor][orderType])
 		}
 	}
 }
 
-func SetCabLights(orders [][]bool, elevConfig *types.ElevConfig) {
-	for floor := range orders {
-		elevio.SetButtonLamp(elevio.BT_Cab, floor, orders[floor][elevio.BT_Cab])
+func logOrder(text string, order types.Order) {
+	slog.Info(text,
+		"order", order.ID,
+		"floor", order.Floor,
+		"button", order.Button,
+		"assignee", order.Assignee,
+	)
+}
+
+func setOrderMetrics(registry types.OrderRegistry, elevConfig *types.ElevConfig) {
+	counts := make(map[elevio.ButtonType]int64)
+
+	for _, order := range orders.AssignedTo(registry, elevConfig.NodeID) {
+		counts[order.Button]++
+	}
+
+	metrics.Orders.With("hall_up").Store(counts[elevio.BT_HallUp])
+	metrics.Orders.With("hall_down").Store(counts[elevio.BT_HallDown])
+	metrics.Orders.With("cab").Store(counts[elevio.BT_Cab])
+}
+
+/*
+ * Blinks a button lamp to tell that a call could not be accepted.
+ * The lamp is left off, done is signalled so the lights can be restored.
+ */
+func BlinkButtonLamp(button elevio.ButtonEvent, done chan<- bool) {
+	for blink := 0; blink < BLINK_COUNT; blink++ {
+		Drv.SetButtonLamp(button.Button, button.Floor, true)
+		time.Sleep(BLINK_PERIOD / 2 * time.Millisecond)
+
+		Drv.SetButtonLamp(button.Button, button.Floor, false)
+		time.Sleep(BLINK_PERIOD / 2 * time.Millisecond)
 	}
+
+	done <- true
+}
+
+func SetCabLights(registry types.OrderRegistry, elevConfig *types.ElevConfig) {
+	for floor := 0; floor < elevConfig.NumFloors; floor++ {
+		Drv.SetButtonLamp(elevio.BT_Cab, floor, orders.Has(registry, elevConfig.NodeID, floor, elevio.BT_Cab))
+	}
+}
+
+/*
+ * Registers a new order which is not yet assigned to any node
+ */
+func AddOrder(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	order types.Order,
+) *types.ElevState {
+
+	orders.Add(elevState.Orders, order)
+
+	return elevState
 }
 
-func SetOrderStatus(
+func AssignOrder(
 	elevState *types.ElevState,
 	elevConfig *types.ElevConfig,
+	order types.Order,
 	assignee int,
+) *types.ElevState {
+
+	oldVersion := elevState.Orders[order.ID].Version
+
+	orders.Assign(elevState.Orders, order, assignee)
+
+	if elevState.Orders[order.ID].Version != oldVersion {
+		events.Publish(events.EV_OrderAssigned, elevState.Orders[order.ID])
+		logOrder("Order assigned", elevState.Orders[order.ID])
+	}
+
+	setOrderMetrics(elevState.Orders, elevConfig)
+
+	SetCabLights(elevState.Orders, elevConfig)
+	SetHallLights(elevState.Orders, elevConfig)
+
+	return elevState
+}
+
+func ApplyAssignments(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	assignments map[string]int,
+) *types.ElevState {
+
+	changed := orders.ChangedAssignments(elevState.Orders, assignments)
+
+	orders.Reassign(elevState.Orders, assignments)
+
+	for id := range changed {
+		events.Publish(events.EV_OrderAssigned, elevState.Orders[id])
+		logOrder("Order reassigned", elevState.Orders[id])
+	}
+
+	setOrderMetrics(elevState.Orders, elevConfig)
+
+	SetCabLights(elevState.Orders, elevConfig)
+	SetHallLights(elevState.Orders, elevConfig)
+
+	return elevState
+}
+
+/*
+ * Cancels a new order no car can serve
+ */
+func RejectOrder(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	order types.Order,
+) *types.ElevState {
+
+	orders.Cancel(elevState.Orders, order)
+	logOrder("Order rejected, no car can serve it", order)
+
+	SetHallLights(elevState.Orders, elevConfig)
+
+	return elevState
+}
+
+func AcknowledgeOrder(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	order types.Order,
+) *types.ElevState {
+
+	orders.Acknowledge(elevState.Orders, order)
+
+	SetHallLights(elevState.Orders, elevConfig)
+
+	return elevState
+}
+
+func ServeOrder(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
 	order types.Order,
-	newStatus bool,
 ) *types.ElevState {
 
-	elevState.Orders[assignee][order.Floor][order.Button] = newStatus
+	wasDone := orders.IsDone(elevState.Orders[order.ID])
+
+	orders.Serve(elevState.Orders, order)
+
+	if !wasDone {
+		events.Publish(events.EV_OrderServed, elevState.Orders[order.ID])
+		logOrder("Order served", elevState.Orders[order.ID])
+	}
+
+	setOrderMetrics(elevState.Orders, elevConfig)
 
-	SetCabLights(elevState.Orders[elevConfig.NodeID], elevConfig)
+	SetCabLights(elevState.Orders, elevConfig)
 	SetHallLights(elevState.Orders, elevConfig)
 
 	return elevState
@@ -203,29 +558,19 @@ func SetOrderStatus(
 
 /*
  * Merges incoming order list with the current order list
- * Hall orders are overwritten while cab orders are ored
+ * See orders.Merge for how conflicting copies of an order are resolved
  */
 func MergeOrderLists(elevState *types.ElevState,
 	elevConfig *types.ElevConfig,
-	newOrders [][][]bool,
+	newOrders types.OrderRegistry,
+	tombstones map[string]types.Tombstone,
 ) *types.ElevState {
 
-	for elevator := range newOrders {
-		for floor := range newOrders[elevator] {
-			for orderType := range newOrders[elevator][floor] {
-				if orderType == elevio.BT_Cab && elevator == elevConfig.NodeID {
-					// Merge cab orders
-					newOrderStatus := newOrders[elevator][floor][orderType] || elevState.Orders[elevator][floor][orderType]
-					elevState.Orders[elevator][floor][orderType] = newOrderStatus
-				} else {
-					// Overwrite hall orders
-					elevState.Orders[elevator][floor][orderType] = newOrders[elevator][floor][orderType]
-				}
-			}
-		}
-	}
+	orders.MergeTombstones(elevState.Orders, tombstones)
+	orders.Merge(elevState.Orders, newOrders)
+	setOrderMetrics(elevState.Orders, elevConfig)
 
-	SetCabLights(elevState.Orders[elevConfig.NodeID], elevConfig)
+	SetCabLights(elevState.Orders, elevConfig)
 	SetHallLights(elevState.Orders, elevConfig)
 
 	return elevState
@@ -238,27 +583,274 @@ func ReassignOrders(
 	bidTxSecure chan<- types.Msg[types.Bid],
 ) {
 
-	for floor := range elevState.Orders[nodeID] {
-		for orderType, orderStatus := range elevState.Orders[nodeID][floor] {
-			if !orderStatus || orderType == elevio.BT_Cab {
-				continue
-			}
+	for _, order := range orders.AssignedTo(elevState.Orders, nodeID) {
+		if order.Button == elevio.BT_Cab {
+			continue
+		}
+
+		metrics.BidsSent.Inc()
+
+		bidTxSecure <- network.FormatBidMsg(
+			nil,
+			order,
+			nodeID,
+			elevConfig.NumNodes,
+			elevState.NextNodeID,
+			elevConfig.NodeID,
+		)
+	}
+}
+
+/*
+ * Out of service the car does not bid, and its hall orders are handed
+ * to the other cars. Cab orders are served or dropped by the maintenance policy.
+ * The stop lamp is lit while out of service.
+ */
+func SetInService(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	inService bool,
+	bidTxSecure chan<- types.Msg[types.Bid],
+) *types.ElevState {
+
+	outOfService := !inService
+
+	// The car is already in or out of service as asked
+	if elevState.OutOfService == outOfService {
+		return elevState
+	}
+
+	elevState.OutOfService = outOfService
+
+	Drv.SetStopLamp(elevState.OutOfService)
+	events.Publish(events.EV_ServiceChanged, inService)
 
-			order := types.Order{
-				Button: elevio.ButtonType(orderType),
-				Floor:  floor,
+	if inService {
+		return elevState
+	}
+
+	if elevConfig.MaintenancePolicy == types.MP_Drop {
+		for _, order := range orders.AssignedTo(elevState.Orders, elevConfig.NodeID) {
+			if order.Button == elevio.BT_Cab {
+				orders.Cancel(elevState.Orders, order)
+				logOrder("Cab order dropped", order)
 			}
+		}
 
-			bidTxSecure <- network.FormatBidMsg(
-				nil,
-				order,
-				nodeID,
-				elevConfig.NumNodes,
-				elevState.NextNodeID,
-				elevConfig.NodeID,
-			)
+		SetCabLights(elevState.Orders, elevConfig)
+		setOrderMetrics(elevState.Orders, elevConfig)
+	}
+
+	handOverHallOrders(elevState, elevConfig, bidTxSecure)
+
+	return elevState
+}
+
+/*
+ * In independent service the car is left out of group dispatch,
+ * and its hall orders are handed to the other cars
+ */
+func SetIndependentService(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	independent bool,
+	bidTxSecure chan<- types.Msg[types.Bid],
+) *types.ElevState {
+
+	if elevState.IndependentService == independent {
+		return elevState
+	}
+
+	elevState.IndependentService = independent
+
+	events.Publish(events.EV_Independent, independent)
+
+	if independent {
+		handOverHallOrders(elevState, elevConfig, bidTxSecure)
+	}
+
+	return elevState
+}
+
+/*
+ * The car powers up again when the night is over
+ */
+func SetTrafficMode(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	mode types.TrafficMode,
+	bidTxSecure chan<- types.Msg[types.Bid],
+) *types.ElevState {
+
+	if elevState.TrafficMode == mode {
+		return elevState
+	}
+
+	elevState.TrafficMode = mode
+
+	slog.Info("Traffic mode changed", "mode", mode)
+	events.Publish(events.EV_TrafficMode, mode.String())
+
+	if mode != types.TM_Night {
+		elevState = SetPoweredDown(elevState, elevConfig, false, bidTxSecure)
+	}
+
+	return elevState
+}
+
+/*
+ * A powered down car is left out of group dispatch
+ * until a cab call wakes it
+ */
+func SetPoweredDown(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	poweredDown bool,
+	bidTxSecure chan<- types.Msg[types.Bid],
+) *types.ElevState {
+
+	if elevState.PoweredDown == poweredDown {
+		return elevState
+	}
+
+	elevState.PoweredDown = poweredDown
+
+	slog.Info("Power changed", "poweredDown", poweredDown)
+	events.Publish(events.EV_PoweredDown, poweredDown)
+
+	if poweredDown {
+		handOverHallOrders(elevState, elevConfig, bidTxSecure)
+	}
+
+	return elevState
+}
+
+/*
+ * A car at full load hands its hall orders to the other cars
+ */
+func SetLoad(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	load int,
+	bidTxSecure chan<- types.Msg[types.Bid],
+) *types.ElevState {
+
+	elevState.Load = load
+	metrics.Load.Set(int64(load))
+
+	fullLoad := load >= FULL_LOAD
+
+	if elevState.FullLoad == fullLoad {
+		return elevState
+	}
+
+	elevState.FullLoad = fullLoad
+
+	slog.Info("Full load changed", "fullLoad", fullLoad, "load", load)
+	events.Publish(events.EV_FullLoad, fullLoad)
+
+	if fullLoad {
+		handOverHallOrders(elevState, elevConfig, bidTxSecure)
+	}
+
+	return elevState
+}
+
+/*
+ * A fire recall cancels every hall and cab call,
+ * and no new calls are taken until it is reset
+ */
+func SetFireRecall(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	recall bool,
+) *types.ElevState {
+
+	if elevState.FireRecall == recall {
+		return elevState
+	}
+
+	elevState.FireRecall = recall
+
+	slog.Warn("Fire recall changed", "recall", recall)
+	events.Publish(events.EV_FireRecall, recall)
+
+	if recall {
+		cancelOrders(elevState, elevConfig, func(order types.Order) bool {
+			return true
+		})
+	}
+
+	return elevState
+}
+
+/*
+ * Phase II can only be entered during a fire recall,
+ * and the cab calls of the car are cancelled when it is left
+ */
+func SetFireService(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	active bool,
+) (*types.ElevState, error) {
+
+	if active && !elevState.FireRecall {
+		return elevState, errors.New("no fire recall is active")
+	}
+
+	if elevState.FireService == active {
+		return elevState, nil
+	}
+
+	elevState.FireService = active
+
+	slog.Warn("Fire service changed", "active", active)
+	events.Publish(events.EV_FireService, active)
+
+	if !active {
+		cancelOrders(elevState, elevConfig, func(order types.Order) bool {
+			return order.Button == elevio.BT_Cab && order.Assignee == elevConfig.NodeID
+		})
+	}
+
+	return elevState, nil
+}
+
+func cancelOrders(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	shouldCancel func(order types.Order) bool,
+) {
+
+	for _, order := range elevState.Orders {
+		if !orders.IsDone(order) && shouldCancel(order) {
+			orders.Cancel(elevState.Orders, order)
+			logOrder("Order cancelled", order)
 		}
 	}
+
+	SetCabLights(elevState.Orders, elevConfig)
+	SetHallLights(elevState.Orders, elevConfig)
+	setOrderMetrics(elevState.Orders, elevConfig)
+}
+
+func handOverHallOrders(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	bidTxSecure chan<- types.Msg[types.Bid],
+) {
+
+	isAlone := elevState.NextNodeID == elevConfig.NodeID
+	disconnected := elevState.NextNodeID == -1
+
+	if !isAlone && !disconnected {
+		ReassignOrders(
+			elevState,
+			elevConfig,
+			elevConfig.NodeID,
+			bidTxSecure,
+		)
+	}
 }
 
 func strArrToInt(strArr []string) []int {
@@ -310,6 +902,84 @@ func SetNextNodeID(
 	return elevState
 }
 
+/*
+ * The live node with the lowest ID coordinates batch reassignment
+ */
+func IsCoordinator(elevConfig *types.ElevConfig, peersStr []string) bool {
+	peers := strArrToInt(peersStr)
+
+	return len(peers) > 0 && slices.Min(peers) == elevConfig.NodeID
+}
+
+func GetCarStatus(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	behaviour types.ElevBehaviour,
+) types.CarStatus {
+
+	status := types.CarStatus{
+		NodeID:       elevConfig.NodeID,
+		NextNodeID:   elevState.NextNodeID,
+		NumFloors:    elevConfig.NumFloors,
+		Floor:        elevState.Floor,
+		Dirn:         elevState.Dirn,
+		Behaviour:    behaviour,
+		DoorObstr:    elevState.DoorObstr,
+		Stuck:        elevState.StuckBetweenFloors,
+		OutOfService: elevState.OutOfService,
+		Independent:  elevState.IndependentService,
+		FireRecall:   elevState.FireRecall,
+		FireService:  elevState.FireService,
+		ParkingFloor: elevState.ParkingFloor,
+		PoweredDown:  elevState.PoweredDown,
+		Load:         elevState.Load,
+	}
+
+	for _, order := range orders.AssignedTo(elevState.Orders, elevConfig.NodeID) {
+		status.Orders = append(status.Orders, order.ButtonEvent)
+	}
+
+	return status
+}
+
+/*
+ * Cars which are obstructed, stuck, out of service, in independent service,
+ * recalled or in fire service do not bid and are not assigned new hall orders
+ */
+func IsAvailable(elevState *types.ElevState) bool {
+	return !elevState.DoorObstr &&
+		!elevState.StuckBetweenFloors &&
+		!elevState.OutOfService &&
+		!elevState.IndependentService &&
+		!elevState.FireRecall &&
+		!elevState.FireService &&
+		!elevState.PoweredDown &&
+		!elevState.FullLoad
+}
+
+func GetCarState(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	behaviour types.ElevBehaviour,
+) types.CarState {
+
+	return types.CarState{
+		NodeID:    elevConfig.NodeID,
+		Floor:     elevState.Floor,
+		Dirn:      elevState.Dirn,
+		Behaviour: behaviour,
+		Available: IsAvailable(elevState),
+		Travel:    elevState.TravelTimes,
+
+		NumFloors:        elevConfig.NumFloors,
+		ServedFloors:     elevConfig.ServedFloors,
+		TravelTime:       elevConfig.TravelTime,
+		DoorOpenDuration: elevConfig.DoorOpenDuration,
+		Capacity:         elevConfig.Capacity,
+		Load:             elevState.Load,
+	}
+}
+
 func ShouldSendSync(
 	nodeID int,
 	oldNextNode int,
@@ -0,0 +1,145 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+ * Events a subscriber can fall behind by before new events are dropped
+ */
+const SUBSCRIBER_BUFFER = 256
+
+/*
+ * Keeps idle connections from being closed by proxies
+ */
+const HEARTBEAT_PERIOD = 15000 // ms
+
+const (
+	EV_ButtonPressed   = "button_pressed"
+	EV_OrderAssigned   = "order_assigned"
+	EV_OrderServed     = "order_served"
+	EV_FloorArrival    = "floor_arrival"
+	EV_DoorOpened      = "door_opened"
+	EV_DoorClosed      = "door_closed"
+	EV_Obstruction     = "obstruction"
+	EV_PeerNew         = "peer_new"
+	EV_PeerLost        = "peer_lost"
+	EV_NextNodeChanged = "next_node_changed"
+	EV_ServiceChanged  = "service_changed"
+	EV_Independent     = "independent_service"
+	EV_FireRecall      = "fire_recall"
+	EV_FireService     = "fire_service"
+	EV_TrafficMode     = "traffic_mode"
+	EV_PoweredDown     = "powered_down"
+	EV_FullLoad        = "full_load"
+)
+
+/*
+ * Time is unix milliseconds, Data depends on the type of event
+ */
+type Event struct {
+	Type   string
+	NodeID int
+	Time   int64
+	Data   any
+}
+
+var nodeID = -1
+
+var lock sync.Mutex
+var subscribers = make(map[chan Event]bool)
+
+func SetNodeID(id int) {
+	nodeID = id
+}
+
+/*
+ * Sends the event to every subscriber without waiting for slow subscribers
+ */
+func Publish(eventType string, data any) {
+	event := Event{
+		Type:   eventType,
+		NodeID: nodeID,
+		Time:   time.Now().UnixMilli(),
+		Data:   data,
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	for subscriber := range subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+/*
+ * Returns the events published from now on, and a function to stop receiving them
+ */
+func Subscribe() (<-chan Event, func()) {
+	subscriber := make(chan Event, SUBSCRIBER_BUFFER)
+
+	lock.Lock()
+	subscribers[subscriber] = true
+	lock.Unlock()
+
+	unsubscribe := func() {
+		lock.Lock()
+		delete(subscribers, subscriber)
+		lock.Unlock()
+	}
+
+	return subscriber, unsubscribe
+}
+
+/*
+ * Streams the events as Server-Sent Events
+ */
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, canFlush := w.(http.Flusher)
+
+		if !canFlush {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		flusher.Flush()
+
+		stream, unsubscribe := Subscribe()
+		defer unsubscribe()
+
+		heartbeat := time.NewTicker(HEARTBEAT_PERIOD * time.Millisecond)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case event := <-stream:
+				encoded, err := json.Marshal(event)
+
+				if err != nil {
+					continue
+				}
+
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, encoded)
+				flusher.Flush()
+
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+				flusher.Flush()
+
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+}
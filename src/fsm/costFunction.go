@@ -4,14 +4,18 @@ import (
 	"Driver-go/elevio"
 	"elevator/orders"
 	"elevator/types"
-	"encoding/json"
 )
 
 const TRAVEL_TIME = 2000 // ms
 
-func deepCopy(obj types.ElevState, copy *types.ElevState) {
-	encodedObj, _ := json.Marshal(obj)
-	_ = json.Unmarshal(encodedObj, copy)
+/*
+ * Times of a car: the measured times where available,
+ * and the travel and door times of the car otherwise
+ */
+type carTimes struct {
+	measured   types.TravelTimes
+	travelTime int
+	doorTime   int
 }
 
 func TimeToOrderServed(elevState *types.ElevState, elevConfig *types.ElevConfig, order types.Order) int {
@@ -19,52 +23,220 @@ func TimeToOrderServed(elevState *types.ElevState, elevConfig *types.ElevConfig,
 		return -1
 	}
 
-	var elevSimState types.ElevState
-	deepCopy(*elevState, &elevSimState)
+	carOrders := carOrders(elevState, elevConfig)
+	carOrders.Set(order.Floor, order.Button)
+
+	timeToServed := -1
+
+	simulate(
+		carOrders,
+		elevState.Floor,
+		elevState.Dirn,
+		state,
+		elevConfig.NumFloors,
+		carTimes{
+			measured:   elevState.TravelTimes,
+			travelTime: elevConfig.TravelTime,
+			doorTime:   elevConfig.DoorOpenDuration,
+		},
+		func(floor int, btn elevio.ButtonType, duration int) bool {
+			if floor != order.Floor || btn != order.Button {
+				return false
+			}
 
-	elevSimState.Orders[elevConfig.NodeID][order.Floor][order.Button] = true
+			timeToServed = duration
+			return true
+		},
+	)
 
-	duration := 0
+	return timeToServed
+}
 
-	switch state {
-	case types.EB_Idle:
-		elevSimState.Dirn = orders.ChooseDirection(&elevSimState, elevConfig).Dirn
+/*
+ * Sum of the times until each of the orders is served,
+ * for a car in the given state serving only these orders.
+ * The times and floors advertised by the car are used, or those
+ * of this car if it did not advertise any.
+ */
+func TimeToAllOrdersServed(
+	car types.CarState,
+	carOrders []types.Order,
+	elevConfig *types.ElevConfig,
+) int {
+
+	if 0 > car.Floor {
+		return -1
+	}
+
+	numFloors := orDefault(car.NumFloors, elevConfig.NumFloors)
 
-		if elevSimState.Dirn == elevio.MD_Stop {
-			return duration
+	orderSet := make(types.CarOrders, numFloors)
+	ordersPerButton := make([][3]int, numFloors)
+
+	for _, order := range carOrders {
+		if order.Floor >= numFloors {
+			return -1
 		}
 
+		orderSet.Set(order.Floor, order.Button)
+		ordersPerButton[order.Floor][order.Button]++
+	}
+
+	totalTime := 0
+
+	completed := simulate(
+		orderSet,
+		car.Floor,
+		car.Dirn,
+		car.Behaviour,
+		numFloors,
+		carTimes{
+			measured:   car.Travel,
+			travelTime: orDefault(car.TravelTime, elevConfig.TravelTime),
+			doorTime:   orDefault(car.DoorOpenDuration, elevConfig.DoorOpenDuration),
+		},
+		func(floor int, btn elevio.ButtonType, duration int) bool {
+			totalTime += duration * ordersPerButton[floor][btn]
+			return false
+		},
+	)
+
+	if !completed {
+		return -1
+	}
+
+	return totalTime
+}
+
+/*
+ * Travel time from a floor to the next in the given direction,
+ * the travel time of the car is used until the segment has been measured
+ */
+func segmentTime(times carTimes, floor int, dirn elevio.MotorDirection) int {
+	segment := floor
+
+	if dirn == elevio.MD_Down {
+		segment = floor - 1
+	}
+
+	if 0 <= segment && segment < len(times.measured.Segments) && times.measured.Segments[segment] > 0 {
+		return times.measured.Segments[segment]
+	}
+
+	return orDefault(times.travelTime, TRAVEL_TIME)
+}
+
+func doorTime(times carTimes) int {
+	if times.measured.DoorDwell > 0 {
+		return times.measured.DoorDwell
+	}
+
+	return times.doorTime
+}
+
+func orDefault(value int, fallback int) int {
+	if value > 0 {
+		return value
+	}
+
+	return fallback
+}
+
+/*
+ * Each stop serves at least one order or turns the car around,
+ * so every order is served within two sweeps of the shaft per order
+ */
+func maxSimulationSteps(numFloors int, carOrders types.CarOrders) int {
+	numOrders := 0
+
+	for floor := range carOrders {
+		for btn := elevio.ButtonType(0); btn < 3; btn++ {
+			if carOrders.Has(floor, btn) {
+				numOrders++
+			}
+		}
+	}
+
+	return 2 * numFloors * (numOrders + 1)
+}
+
+/*
+ * Simulates a car serving the order set, starting in the given behaviour.
+ * Travel and door times are taken from the measured times where available.
+ * served is called with the time at which each button is served, and the simulation
+ * stops when it returns true or the order set is empty. The order set is modified.
+ *
+ * Returns false if the simulation did not finish within the step limit.
+ */
+func simulate(
+	carOrders types.CarOrders,
+	floor int,
+	dirn elevio.MotorDirection,
+	behaviour types.ElevBehaviour,
+	numFloors int,
+	times carTimes,
+	served func(floor int, btn elevio.ButtonType, duration int) bool,
+) bool {
+
+	duration := 0
+	stopped := true
+
+	switch behaviour {
+	case types.EB_Idle:
+		dirn = orders.ChooseCarDirection(carOrders, floor, dirn).Dirn
+
 	case types.EB_Moving:
-		duration += TRAVEL_TIME / 2
-		elevSimState.Floor += int(elevSimState.Dirn)
+		duration += segmentTime(times, floor, dirn) / 2
+		floor += int(dirn)
+		stopped = false
 
 	case types.EB_DoorOpen:
-		duration -= elevConfig.DoorOpenDuration / 2
+		duration -= doorTime(times) / 2
 	}
 
-	for {
-		if orders.ShouldStop(&elevSimState, elevConfig) {
-			shouldClear := orders.ClearAtCurrentFloor(&elevSimState, elevConfig)
+	maxSteps := maxSimulationSteps(numFloors, carOrders)
 
-			if order.Floor == elevSimState.Floor && shouldClear[order.Button] {
-				if 0 > duration {
-					duration = 0
-				}
-				return duration
-			}
+	for step := 0; step < maxSteps; step++ {
+		if 0 > floor || floor >= len(carOrders) {
+			return false
+		}
+
+		if orders.CarShouldStop(carOrders, floor, dirn) {
+			shouldClear := orders.CarClearAtFloor(carOrders, floor, dirn)
 
-			// TODO: Add clear order func
 			for btn, clearButton := range shouldClear {
-				if clearButton {
-					elevSimState.Orders[elevConfig.NodeID][elevSimState.Floor][btn] = false
+				if !clearButton || !carOrders.Has(floor, elevio.ButtonType(btn)) {
+					continue
+				}
+
+				carOrders.Clear(floor, elevio.ButtonType(btn))
+
+				if served(floor, elevio.ButtonType(btn), max(duration, 0)) {
+					return true
 				}
 			}
 
-			duration += elevConfig.DoorOpenDuration
-			elevSimState.Dirn = orders.ChooseDirection(&elevSimState, elevConfig).Dirn
+			if carOrders.Empty() {
+				return true
+			}
+
+			duration += doorTime(times)
+			dirn = orders.ChooseCarDirection(carOrders, floor, dirn).Dirn
+			stopped = true
+		}
+
+		if dirn == elevio.MD_Stop {
+			continue
 		}
 
-		elevSimState.Floor += int(elevSimState.Dirn)
-		duration += TRAVEL_TIME
+		if stopped {
+			duration += times.measured.StopOverhead
+			stopped = false
+		}
+
+		duration += segmentTime(times, floor, dirn)
+		floor += int(dirn)
 	}
+
+	return false
 }
@@ -0,0 +1,182 @@
+package fsm
+
+import (
+	"Driver-go/elevio"
+	"elevator/orders"
+	"elevator/types"
+	"fmt"
+	"testing"
+)
+
+/*
+ * Measures the time it takes a node to evaluate a bid:
+ * - The car is halfway up the shaft on its way up
+ * - Every other floor has a cab order and every third floor a hall order
+ * - The bid is for a hall order at the bottom floor
+ */
+func BenchmarkTimeToOrderServed(b *testing.B) {
+	for _, numFloors := range []int{4, 20, 100} {
+		elevConfig := &types.ElevConfig{
+			NodeID:           0,
+			NumNodes:         1,
+			NumFloors:        numFloors,
+			NumButtons:       3,
+			DoorOpenDuration: 3000,
+			TravelTime:       TRAVEL_TIME,
+		}
+
+		elevState := &types.ElevState{
+			Floor:  numFloors / 2,
+			Dirn:   elevio.MD_Up,
+			Orders: make(types.OrderRegistry),
+		}
+
+		for floor := 0; floor < numFloors; floor++ {
+			if floor%2 == 0 {
+				cabOrder := orders.New(elevio.ButtonEvent{Floor: floor, Button: elevio.BT_Cab}, 0)
+				cabOrder.ID += fmt.Sprintf("-%d-cab", floor)
+				orders.Assign(elevState.Orders, cabOrder, 0)
+			}
+
+			if floor%3 == 0 {
+				hallOrder := orders.New(elevio.ButtonEvent{Floor: floor, Button: elevio.BT_HallDown}, 0)
+				hallOrder.ID += fmt.Sprintf("-%d-hall", floor)
+				orders.Assign(elevState.Orders, hallOrder, 0)
+			}
+		}
+
+		newOrder := orders.New(elevio.ButtonEvent{Floor: 0, Button: elevio.BT_HallUp}, 0)
+
+		b.Run(fmt.Sprintf("%d floors", numFloors), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				TimeToOrderServed(elevState, elevConfig, newOrder)
+			}
+		})
+	}
+}
+
+/*
+ * The cost of a bid follows the orders the car will stop for
+ */
+func TestTimeToOrderServedSkipsBypassedOrders(t *testing.T) {
+	elevConfig := &types.ElevConfig{
+		NodeID:           0,
+		NumNodes:         1,
+		NumFloors:        4,
+		NumButtons:       3,
+		DoorOpenDuration: 3000,
+		TravelTime:       TRAVEL_TIME,
+		ServedFloors:     []bool{true, true, true, false},
+	}
+
+	elevState := &types.ElevState{
+		Floor:  0,
+		Dirn:   elevio.MD_Stop,
+		Orders: make(types.OrderRegistry),
+	}
+
+	hallOrder := orders.New(elevio.ButtonEvent{Floor: 1, Button: elevio.BT_HallUp}, 0)
+	orders.Assign(elevState.Orders, hallOrder, 0)
+
+	unservedOrder := orders.New(elevio.ButtonEvent{Floor: 3, Button: elevio.BT_Cab}, 0)
+	unservedOrder.ID += "-unserved"
+	orders.Assign(elevState.Orders, unservedOrder, 0)
+
+	newOrder := orders.New(elevio.ButtonEvent{Floor: 2, Button: elevio.BT_Cab}, 0)
+	newOrder.ID += "-new"
+
+	stopping := TimeToOrderServed(elevState, elevConfig, newOrder)
+
+	elevState.FullLoad = true
+
+	bypassing := TimeToOrderServed(elevState, elevConfig, newOrder)
+
+	if want := 2 * TRAVEL_TIME; bypassing != want {
+		t.Errorf("got %d ms at full load, want %d ms without stopping on the way", bypassing, want)
+	}
+
+	if stopping <= bypassing {
+		t.Errorf("got %d ms stopping on the way, want more than %d ms", stopping, bypassing)
+	}
+}
+
+/*
+ * The coordinator costs each car with the times and floors it advertised,
+ * falling back to its own only where the car advertised none
+ */
+func TestTimeToAllOrdersServedAdvertised(t *testing.T) {
+	elevConfig := &types.ElevConfig{
+		NodeID:           0,
+		NumNodes:         2,
+		NumFloors:        4,
+		NumButtons:       3,
+		DoorOpenDuration: 3000,
+		TravelTime:       TRAVEL_TIME,
+	}
+
+	hallAndCab := []types.Order{
+		{ButtonEvent: elevio.ButtonEvent{Floor: 1, Button: elevio.BT_HallUp}},
+		{ButtonEvent: elevio.ButtonEvent{Floor: 3, Button: elevio.BT_Cab}},
+	}
+
+	topFloor := []types.Order{
+		{ButtonEvent: elevio.ButtonEvent{Floor: 5, Button: elevio.BT_Cab}},
+	}
+
+	tests := []struct {
+		name   string
+		car    types.CarState
+		orders []types.Order
+		want   int
+	}{
+		{
+			name:   "nothing advertised",
+			car:    types.CarState{NodeID: 1, Floor: 0, Behaviour: types.EB_Idle},
+			orders: hallAndCab,
+			want:   2000 + (2000 + 3000 + 2*2000),
+		},
+		{
+			name:   "advertised times",
+			car:    types.CarState{NodeID: 1, Floor: 0, Behaviour: types.EB_Idle, TravelTime: 1000, DoorOpenDuration: 1000},
+			orders: hallAndCab,
+			want:   1000 + (1000 + 1000 + 2*1000),
+		},
+		{
+			name: "measured times before advertised times",
+			car: types.CarState{
+				NodeID:           1,
+				Floor:            0,
+				Behaviour:        types.EB_Idle,
+				Travel:           types.TravelTimes{Segments: []int{500, 500, 500}, DoorDwell: 2000},
+				TravelTime:       1000,
+				DoorOpenDuration: 1000,
+			},
+			orders: hallAndCab,
+			want:   500 + (500 + 2000 + 2*500),
+		},
+		{
+			name:   "advertised floors above the local shaft",
+			car:    types.CarState{NodeID: 1, Floor: 0, Behaviour: types.EB_Idle, NumFloors: 6, TravelTime: 1000},
+			orders: topFloor,
+			want:   5 * 1000,
+		},
+		{
+			name:   "order above the advertised shaft",
+			car:    types.CarState{NodeID: 1, Floor: 0, Behaviour: types.EB_Idle, NumFloors: 3},
+			orders: hallAndCab,
+			want:   -1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := TimeToAllOrdersServed(test.car, test.orders, elevConfig)
+
+			if got != test.want {
+				t.Errorf("got %d ms, want %d ms", got, test.want)
+			}
+		})
+	}
+}
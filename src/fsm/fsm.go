@@ -4,12 +4,145 @@ import (
 	"Driver-go/elevio"
 	"elevator/orders"
 	"elevator/types"
+	"log/slog"
 )
 
 var state types.ElevBehaviour = types.EB_Idle
 
 func OnInitBetweenFloors() {
-	state = types.EB_Moving
+	setState(types.EB_Moving)
+}
+
+func setState(newState types.ElevBehaviour) {
+	if newState != state {
+		slog.Info("Behaviour changed", "from", state, "to", newState)
+	}
+
+	state = newState
+}
+
+func Behaviour() types.ElevBehaviour {
+	return state
+}
+
+/*
+ * In independent service and fire service the car only answers cab calls,
+ * and at full load it passes hall calls without stopping
+ */
+func answersHallCalls(elevState *types.ElevState) bool {
+	return !elevState.IndependentService && !elevState.FireService && !elevState.FullLoad
+}
+
+/*
+ * Orders at floors the car does not serve are left for the other cars
+ */
+func carOrders(elevState *types.ElevState, elevConfig *types.ElevConfig) types.CarOrders {
+	carOrders := orders.CarOrdersOf(elevState.Orders, elevConfig.NodeID, elevConfig.NumFloors)
+
+	for floor := range carOrders {
+		if !orders.Serves(elevConfig.ServedFloors, floor) {
+			carOrders.Clear(floor, elevio.BT_HallUp)
+			carOrders.Clear(floor, elevio.BT_HallDown)
+			carOrders.Clear(floor, elevio.BT_Cab)
+		}
+	}
+
+	if !answersHallCalls(elevState) {
+		for floor := range carOrders {
+			carOrders.Clear(floor, elevio.BT_HallUp)
+			carOrders.Clear(floor, elevio.BT_HallDown)
+		}
+	}
+
+	return carOrders
+}
+
+/*
+ * Floor the car goes to without stopping on the way, if any:
+ * the recall floor on a fire recall, the maintenance floor
+ * once the car is out of service and has no orders left,
+ * the nearest served floor if the car has stopped at a floor
+ * it does not serve, or the floor an idle car parks at
+ */
+func parkingFloor(elevState *types.ElevState, elevConfig *types.ElevConfig) (int, bool) {
+	switch {
+	case elevState.FireRecall && !elevState.FireService:
+		return elevConfig.RecallFloor, true
+
+	case elevState.OutOfService && carOrders(elevState, elevConfig).Empty():
+		return elevConfig.MaintenanceFloor, true
+
+	case !orders.Serves(elevConfig.ServedFloors, elevState.Floor) && carOrders(elevState, elevConfig).Empty():
+		return orders.NearestServedFloor(elevConfig.ServedFloors, elevState.Floor), true
+
+	case elevState.ParkingFloor >= 0 && carOrders(elevState, elevConfig).Empty():
+		return elevState.ParkingFloor, true
+	}
+
+	return -1, false
+}
+
+/*
+ * Recalled cars and cars out of service hold the door open once parked,
+ * an idle car waits at its parking floor with the door closed
+ */
+func parkingDirection(elevState *types.ElevState, floor int) types.DirnBehaviourPair {
+	pair := orders.ParkingDirection(elevState.Floor, floor)
+
+	holdsDoor := (elevState.FireRecall && !elevState.FireService) || elevState.OutOfService
+
+	if pair.Behaviour == types.EB_Idle && holdsDoor {
+		pair.Behaviour = types.EB_DoorOpen
+	}
+
+	return pair
+}
+
+/*
+ * A parked car holds the door open. In independent service the door
+ * is held open until a cab call is made, and in fire service
+ * the car only leaves while the door close input is held.
+ */
+func chooseDirection(elevState *types.ElevState, elevConfig *types.ElevConfig) types.DirnBehaviourPair {
+	if floor, parking := parkingFloor(elevState, elevConfig); parking {
+		return parkingDirection(elevState, floor)
+	}
+
+	pair := orders.ChooseCarDirection(carOrders(elevState, elevConfig), elevState.Floor, elevState.Dirn)
+
+	holdDoor := types.DirnBehaviourPair{Dirn: elevio.MD_Stop, Behaviour: types.EB_DoorOpen}
+
+	switch {
+	case elevState.FireService && (pair.Behaviour != types.EB_Moving || !elevState.DoorCloseHeld):
+		return holdDoor
+
+	case elevState.IndependentService && pair.Behaviour == types.EB_Idle:
+		return holdDoor
+	}
+
+	return pair
+}
+
+/*
+ * The car passes through the floors it does not serve
+ */
+func shouldStopAtFloor(elevState *types.ElevState, elevConfig *types.ElevConfig) bool {
+	if !orders.Serves(elevConfig.ServedFloors, elevState.Floor) {
+		return false
+	}
+
+	return orders.CarShouldStop(carOrders(elevState, elevConfig), elevState.Floor, elevState.Dirn)
+}
+
+func clearAtCurrentFloor(elevState *types.ElevState, elevConfig *types.ElevConfig) [3]bool {
+	clearOrders := orders.CarClearAtFloor(carOrders(elevState, elevConfig), elevState.Floor, elevState.Dirn)
+
+	if !answersHallCalls(elevState) {
+		clearOrders[elevio.BT_HallUp] = false
+		clearOrders[elevio.BT_HallDown] = false
+	}
+
+	return clearOrders
 }
 
 func OnOrderAssigned(
@@ -25,20 +158,26 @@ func OnOrderAssigned(
 
 	switch state {
 	case types.EB_DoorOpen:
+		isHallOrder := newOrder.Button != elevio.BT_Cab
+
+		if !answersHallCalls(elevState) && isHallOrder {
+			break
+		}
+
 		if orders.ShouldClearImmediately(elevState, newOrder) {
 			output.StartDoorTimer = true
 			output.ClearOrders[newOrder.Button] = true
 		}
 
 	case types.EB_Idle:
-		pair := orders.ChooseDirection(elevState, elevConfig)
+		pair := chooseDirection(elevState, elevConfig)
 
 		output.ElevDirn = pair.Dirn
-		state = pair.Behaviour
+		setState(pair.Behaviour)
 
 		switch state {
 		case types.EB_DoorOpen:
-			output.ClearOrders = orders.ClearAtCurrentFloor(elevState, elevConfig)
+			output.ClearOrders = clearAtCurrentFloor(elevState, elevConfig)
 			output.Door = true
 			output.StartDoorTimer = true
 
@@ -61,7 +200,34 @@ func OnFloorArrival(
 		Door:     state == types.EB_DoorOpen,
 	}
 
-	shouldStop := orders.ShouldStop(elevState, elevConfig)
+	/*
+	 * On the way to park, the car only stops at the parking floor,
+	 * and turns if it was heading away from it
+	 */
+	floor, parking := parkingFloor(elevState, elevConfig)
+
+	if state == types.EB_Moving && parking {
+		pair := parkingDirection(elevState, floor)
+
+		output.ElevDirn = pair.Dirn
+		output.MotorDirn = pair.Dirn
+		output.SetMotor = pair.Dirn != elevState.Dirn
+
+		switch pair.Behaviour {
+		case types.EB_DoorOpen:
+			output.Door = true
+			output.StartDoorTimer = true
+
+			setState(types.EB_DoorOpen)
+
+		case types.EB_Idle:
+			setState(types.EB_Idle)
+		}
+
+		return output
+	}
+
+	shouldStop := shouldStopAtFloor(elevState, elevConfig)
 
 	if state == types.EB_Moving && shouldStop {
 		output.MotorDirn = elevio.MD_Stop
@@ -70,9 +236,9 @@ func OnFloorArrival(
 		output.Door = true
 		output.StartDoorTimer = true
 
-		output.ClearOrders = orders.ClearAtCurrentFloor(elevState, elevConfig)
+		output.ClearOrders = clearAtCurrentFloor(elevState, elevConfig)
 
-		state = types.EB_DoorOpen
+		setState(types.EB_DoorOpen)
 	}
 
 	return output
@@ -92,14 +258,14 @@ func OnDoorTimeout(
 		return output
 	}
 
-	pair := orders.ChooseDirection(elevState, elevConfig)
+	pair := chooseDirection(elevState, elevConfig)
 
 	output.ElevDirn = pair.Dirn
-	state = pair.Behaviour
+	setState(pair.Behaviour)
 
 	if state == types.EB_DoorOpen {
 		output.StartDoorTimer = true
-		output.ClearOrders = orders.ClearAtCurrentFloor(elevState, elevConfig)
+		output.ClearOrders = clearAtCurrentFloor(elevState, elevConfig)
 	} else {
 		output.Door = false
 		output.MotorDirn = pair.Dirn
@@ -109,6 +275,43 @@ func OnDoorTimeout(
 	return output
 }
 
+/*
+ * When the service mode changes, an idle car goes to park or opens
+ * the door. A busy car does so once it reaches a floor or closes the door.
+ */
+func OnServiceChanged(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+) types.FsmOutput {
+
+	output := types.FsmOutput{
+		ElevDirn: elevState.Dirn,
+		Door:     state == types.EB_DoorOpen,
+	}
+
+	if state != types.EB_Idle {
+		return output
+	}
+
+	pair := chooseDirection(elevState, elevConfig)
+
+	output.ElevDirn = pair.Dirn
+	setState(pair.Behaviour)
+
+	switch state {
+	case types.EB_DoorOpen:
+		output.ClearOrders = clearAtCurrentFloor(elevState, elevConfig)
+		output.Door = true
+		output.StartDoorTimer = true
+
+	case types.EB_Moving:
+		output.MotorDirn = pair.Dirn
+		output.SetMotor = true
+	}
+
+	return output
+}
+
 func OnSync(
 	elevState *types.ElevState,
 	elevConfig *types.ElevConfig,
@@ -119,14 +322,14 @@ func OnSync(
 		Door:     state == types.EB_DoorOpen,
 	}
 
-	pair := orders.ChooseDirection(elevState, elevConfig)
+	pair := chooseDirection(elevState, elevConfig)
 
 	output.ElevDirn = pair.Dirn
-	state = pair.Behaviour
+	setState(pair.Behaviour)
 
 	if state == types.EB_DoorOpen {
 		output.StartDoorTimer = true
-		output.ClearOrders = orders.ClearAtCurrentFloor(elevState, elevConfig)
+		output.ClearOrders = clearAtCurrentFloor(elevState, elevConfig)
 	} else {
 		output.Door = false
 		output.MotorDirn = pair.Dirn
@@ -0,0 +1,171 @@
+package journal
+
+import (
+	"bufio"
+	"elevator/clock"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"time"
+)
+
+type Kind string
+
+const (
+	JK_Start     Kind = "start"
+	JK_Button    Kind = "button"
+	JK_Floor     Kind = "floor"
+	JK_Obstr     Kind = "obstr"
+	JK_KeySwitch Kind = "keyswitch"
+	JK_Peers     Kind = "peers"
+	JK_Timeout   Kind = "timeout"
+	JK_Blink     Kind = "blink"
+	JK_Api       Kind = "api"
+	JK_Bid       Kind = "bid"
+	JK_Assign    Kind = "assign"
+	JK_Served    Kind = "served"
+	JK_Sync      Kind = "sync"
+	JK_Census    Kind = "census"
+	JK_Reassign  Kind = "reassign"
+	JK_Fire      Kind = "fire"
+	JK_DoorClose Kind = "doorclose"
+	JK_Status    Kind = "status"
+	JK_Mode      Kind = "mode"
+	JK_Load      Kind = "load"
+)
+
+/*
+ * One input to the main loop, Time is unix nanoseconds
+ */
+type Entry struct {
+	Time int64
+	Kind Kind
+	Data json.RawMessage
+}
+
+/*
+ * Node configuration and floor sensor at startup, the first entry of a journal
+ */
+type Start struct {
+	NodeID             int
+	NumNodes           int
+	NumFloors          int
+	HallLightGuarantee bool
+	OfflinePolicy      int
+	Dispatch           string
+	MaintenanceFloor   int
+	MaintenancePolicy  int
+	Maintenance        bool
+	RecallFloor        int
+	ServedFloors       []bool
+	TravelTime         int
+	DoorOpenDuration   int
+	Capacity           int
+	ParkStrategy       int
+	HomeFloor          int
+	ParkAfter          int
+	Lobby              int
+	LobbyFrom          int
+	LobbyTo            int
+	Calendar           string
+	InitialFloor       int
+}
+
+type Timeout struct {
+	Timer string
+}
+
+type ApiRequest struct {
+	Kind        int
+	InService   bool
+	Independent bool
+	Recall      bool
+	FireService bool
+}
+
+/*
+ * The main loop calls Record when it takes an input,
+ * and Step before it waits for the next input
+ */
+type Journal interface {
+	Record(kind Kind, data any)
+	Step()
+}
+
+/*
+ * Appends every input to a file, or only stops the clock if there is no file
+ */
+type Writer struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func NewWriter(path string) (*Writer, error) {
+	if len(path) == 0 {
+		return &Writer{}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (w *Writer) Record(kind Kind, data any) {
+	now := time.Now()
+	clock.Set(now)
+
+	if w.file == nil {
+		return
+	}
+
+	encoded, err := json.Marshal(data)
+
+	if err != nil {
+		slog.Error("Could not journal input", "kind", kind, "err", err)
+		return
+	}
+
+	err = w.encoder.Encode(Entry{Time: now.UnixNano(), Kind: kind, Data: encoded})
+
+	if err != nil {
+		slog.Error("Could not journal input", "kind", kind, "err", err)
+	}
+}
+
+func (w *Writer) Step() {}
+
+/*
+ * Returns every entry of a journal file in order
+ */
+func Read(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var entries []Entry
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<24)
+
+	for scanner.Scan() {
+		var entry Entry
+
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
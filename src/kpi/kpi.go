@@ -0,0 +1,265 @@
+package kpi
+
+import (
+	"Driver-go/elevio"
+	"elevator/types"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+/*
+ * Hall calls waiting longer than this are counted as long waits
+ */
+const LONG_WAIT = 60000 // ms
+
+/*
+ * Number of served orders kept, the oldest are dropped first
+ */
+const MAX_RECORDS = 100000
+
+/*
+ * Service times of a served order in milliseconds.
+ * Wait is from the hall button press until the door opens,
+ * journey is from the cab button press until the door opens at the destination.
+ */
+type record struct {
+	assignee      int
+	floor         int
+	hallCall      bool
+	wait          int64
+	journey       int64
+	reassignments int
+}
+
+/*
+ * Collects the served orders of every car in the ring.
+ * Served messages go around the whole ring, so every node
+ * sees the orders served by every car.
+ */
+type Recorder struct {
+	records  []record
+	recorded map[string]bool
+}
+
+type Summary struct {
+	Scope            string
+	Orders           int
+	HallCalls        int
+	AvgWait          int64
+	P95Wait          int64
+	LongWaits        int
+	AvgJourney       int64
+	P95Journey       int64
+	AvgReassignments float64
+}
+
+type Report struct {
+	Cluster Summary
+	Nodes   []Summary
+	Floors  []Summary
+}
+
+func New() *Recorder {
+	return &Recorder{recorded: make(map[string]bool)}
+}
+
+/*
+ * Records the served orders of the registry which are not yet recorded.
+ * An order only known from its tombstone has no creation time and is not recorded.
+ * Must be called more often than orders.SERVED_RETENTION.
+ */
+func (r *Recorder) Collect(registry types.OrderRegistry) {
+	for id, order := range registry {
+		if order.State != types.OS_Served || order.CreatedAt == 0 || r.recorded[id] {
+			continue
+		}
+
+		r.recorded[id] = true
+		r.records = append(r.records, newRecord(order))
+	}
+
+	if len(r.records) > MAX_RECORDS {
+		r.records = slices.Clone(r.records[len(r.records)-MAX_RECORDS:])
+	}
+
+	/*
+	 * Forget orders the registry has pruned, they can not be collected twice
+	 */
+	for id := range r.recorded {
+		if _, exists := registry[id]; !exists {
+			delete(r.recorded, id)
+		}
+	}
+}
+
+func newRecord(order types.Order) record {
+	rec := record{
+		assignee:      order.Assignee,
+		floor:         order.Floor,
+		hallCall:      order.Button != elevio.BT_Cab,
+		reassignments: order.Reassignments,
+	}
+
+	if rec.hallCall {
+		rec.wait = max(order.ServedAt-order.CreatedAt, 0)
+	} else {
+		rec.journey = max(order.ServedAt-order.CreatedAt, 0)
+	}
+
+	return rec
+}
+
+/*
+ * Returns the KPIs of all cars together, of each car and of each floor
+ */
+func (r *Recorder) Report(elevConfig *types.ElevConfig) Report {
+	report := Report{
+		Cluster: summarise("cluster", r.records),
+	}
+
+	for nodeID := 0; nodeID < elevConfig.NumNodes; nodeID++ {
+		nodeRecords := filter(r.records, func(rec record) bool { return rec.assignee == nodeID })
+		report.Nodes = append(report.Nodes, summarise(fmt.Sprintf("node %d", nodeID), nodeRecords))
+	}
+
+	for floor := 0; floor < elevConfig.NumFloors; floor++ {
+		floorRecords := filter(r.records, func(rec record) bool { return rec.floor == floor })
+		report.Floors = append(report.Floors, summarise(fmt.Sprintf("floor %d", floor), floorRecords))
+	}
+
+	return report
+}
+
+func filter(records []record, keep func(record) bool) []record {
+	var kept []record
+
+	for _, rec := range records {
+		if keep(rec) {
+			kept = append(kept, rec)
+		}
+	}
+
+	return kept
+}
+
+func summarise(scope string, records []record) Summary {
+	summary := Summary{Scope: scope, Orders: len(records)}
+
+	var waits []int64
+	var journeys []int64
+	reassignments := 0
+
+	for _, rec := range records {
+		reassignments += rec.reassignments
+
+		if rec.hallCall {
+			waits = append(waits, rec.wait)
+		} else {
+			journeys = append(journeys, rec.journey)
+		}
+	}
+
+	summary.HallCalls = len(waits)
+	summary.AvgWait, summary.P95Wait = meanAndP95(waits)
+	summary.AvgJourney, summary.P95Journey = meanAndP95(journeys)
+
+	for _, wait := range waits {
+		if wait > LONG_WAIT {
+			summary.LongWaits++
+		}
+	}
+
+	if len(records) > 0 {
+		summary.AvgReassignments = float64(reassignments) / float64(len(records))
+	}
+
+	return summary
+}
+
+/*
+ * Nearest rank 95th percentile, both are 0 without samples
+ */
+func meanAndP95(samples []int64) (int64, int64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+
+	slices.Sort(samples)
+
+	var sum int64
+
+	for _, sample := range samples {
+		sum += sample
+	}
+
+	rank := (95*len(samples) + 99) / 100
+
+	return sum / int64(len(samples)), samples[rank-1]
+}
+
+/*
+ * Writes the report as CSV if the file ends in .csv, otherwise as JSON
+ */
+func (report Report) Write(path string) error {
+	if filepath.Ext(path) == ".csv" {
+		return report.writeCsv(path)
+	}
+
+	encoded, err := json.MarshalIndent(report, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, encoded, 0644)
+}
+
+func (report Report) writeCsv(path string) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+
+	writer.Write([]string{
+		"scope",
+		"orders",
+		"hall_calls",
+		"avg_wait_ms",
+		"p95_wait_ms",
+		"long_waits",
+		"avg_journey_ms",
+		"p95_journey_ms",
+		"avg_reassignments",
+	})
+
+	summaries := append([]Summary{report.Cluster}, report.Nodes...)
+	summaries = append(summaries, report.Floors...)
+
+	for _, summary := range summaries {
+		writer.Write([]string{
+			summary.Scope,
+			strconv.Itoa(summary.Orders),
+			strconv.Itoa(summary.HallCalls),
+			strconv.FormatInt(summary.AvgWait, 10),
+			strconv.FormatInt(summary.P95Wait, 10),
+			strconv.Itoa(summary.LongWaits),
+			strconv.FormatInt(summary.AvgJourney, 10),
+			strconv.FormatInt(summary.P95Journey, 10),
+			strconv.FormatFloat(summary.AvgReassignments, 'f', 2, 64),
+		})
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+/*
+ * File is empty to log to stderr.
+ * A log file is rotated when it grows past MaxSize megabytes,
+ * keeping MaxBackups old files named <File>.1 (newest) to <File>.<MaxBackups>.
+ */
+type Config struct {
+	Level      string
+	File       string
+	Json       bool
+	MaxSize    int
+	MaxBackups int
+}
+
+var levels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+func ValidLevel(level string) bool {
+	_, valid := levels[strings.ToLower(level)]
+	return valid
+}
+
+/*
+ * Replaces the default logger, every record is tagged with the node ID
+ */
+func Setup(config Config, nodeID int) error {
+	var output io.Writer = os.Stderr
+
+	if len(config.File) > 0 {
+		file, err := newRotatingFile(config.File, int64(config.MaxSize)<<20, config.MaxBackups)
+
+		if err != nil {
+			return err
+		}
+
+		output = file
+	}
+
+	options := &slog.HandlerOptions{Level: levels[strings.ToLower(config.Level)]}
+
+	var handler slog.Handler
+
+	if config.Json {
+		handler = slog.NewJSONHandler(output, options)
+	} else {
+		handler = slog.NewTextHandler(output, options)
+	}
+
+	slog.SetDefault(slog.New(handler).With("node", nodeID))
+
+	return nil
+}
+
+type rotatingFile struct {
+	lock       sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+
+	err := r.open()
+
+	return r, err
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		err := r.rotate()
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+
+	return n, err
+}
+
+/*
+ * Shifts the backups up by one, dropping the oldest
+ */
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+
+	if r.maxBackups > 0 {
+		for backup := r.maxBackups - 1; backup > 0; backup-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, backup), fmt.Sprintf("%s.%d", r.path, backup+1))
+		}
+
+		os.Rename(r.path, r.path+".1")
+	} else {
+		os.Remove(r.path)
+	}
+
+	return r.open()
+}
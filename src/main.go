@@ -2,13 +2,28 @@ package main
 
 import (
 	"Driver-go/elevio"
-	"Network-go/bcast"
-	"Network-go/peers"
+	"elevator/api"
+	"elevator/calib"
+	"elevator/clock"
+	"elevator/dash"
+	"elevator/dispatch"
 	"elevator/elev"
+	"elevator/events"
 	"elevator/fsm"
+	"elevator/journal"
+	"elevator/kpi"
+	"elevator/logging"
+	"elevator/metrics"
 	"elevator/network"
-	"elevator/timer"
+	"elevator/orders"
+	"elevator/parking"
+	"elevator/trace"
+	"elevator/traffic"
 	"elevator/types"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
 	"slices"
 	"strconv"
 	"time"
@@ -16,101 +31,179 @@ import (
 
 const BCAST_PORT = 16491
 const PEER_PORT = 17441
+const INJECT_PORT = 18723
+const STATUS_PORT = 19237
 
 const NUM_BUTTONS = 3
+
+/*
+ * Floors of the building, the shaft of a car may reach fewer
+ */
 const NUM_FLOORS = 4
+const CAPACITY = 8
 
 const DOOR_OPEN_DURATION = 3000 // ms
 const DOOR_OBSTR_TIMEOUT = 6000 // ms
 const FLOOR_ARRIVAL_TIMEOUT = 6000 // ms
+const REASSIGN_PERIOD = 10000 // ms
+const KPI_PERIOD = 10000 // ms
+const STATUS_PERIOD = 500 // ms
+const PARK_PERIOD = 1000 // ms
+const MODE_PERIOD = 10000 // ms
+const PRUNE_PERIOD = 10000 // ms
+const CALIB_PERIOD = 10000 // ms
 
 func main() {
-	nodeID, numNodes, elevServerPort := parseCommandlineFlags()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "traffic":
+			traffic.Run(os.Args[2:], BCAST_PORT, INJECT_PORT)
+			return
+
+		case "dash":
+			dash.Run(os.Args[2:], BCAST_PORT, STATUS_PORT)
+			return
+
+		case "replay":
+			runReplay(os.Args[2:])
+			return
+		}
+	}
 
-	elevConfig := elev.InitConfig(
-		nodeID,
-		numNodes,
-		NUM_FLOORS,
-		NUM_BUTTONS,
-		DOOR_OPEN_DURATION,
-	)
+	flags := parseCommandlineFlags()
 
-	elevState := elev.InitState(elevConfig)
+	err := logging.Setup(flags.logConfig, flags.nodeID)
 
-	drvButtons, drvFloors, drvObstr := elev.InitDriver(elevState, elevConfig, elevServerPort)
+	if err != nil {
+		fmt.Println("Error: Logging:", err)
+		os.Exit(1)
+	}
 
-	doorTimeout, doorTimer := timer.New(DOOR_OPEN_DURATION * time.Millisecond)
-	obstrTimeout, obstrTimer := timer.New(DOOR_OBSTR_TIMEOUT * time.Millisecond)
-	floorTimeout, floorTimer := timer.New(FLOOR_ARRIVAL_TIMEOUT * time.Millisecond)
+	err = trace.Setup(flags.traceFile, flags.nodeID)
 
-	/*
-	 * Setup network communication channels
-	 */
+	if err != nil {
+		fmt.Println("Error: Trace:", err)
+		os.Exit(1)
+	}
 
-	bidTx := make(chan types.Msg[types.Bid])
-	bidTxSecure := make(chan types.Msg[types.Bid])
-	bidRx := make(chan types.Msg[types.Bid])
+	runNode(flags, liveIO)
+}
 
-	bidSetRecipient := make(chan int)
-	bidReplyReceived := make(chan string)
+/*
+ * Runs the node on the inputs and outputs given by setup
+ */
+func runNode(
+	flags cmdFlags,
+	setup func(flags cmdFlags, elevState *types.ElevState, elevConfig *types.ElevConfig) *nodeIO,
+) {
 
-	go network.SecureTransmitter[types.Bid](
-		bidSetRecipient,
-		bidReplyReceived,
-		bidTx,
-		bidTxSecure,
+	elevConfig := elev.InitConfig(
+		flags.nodeID,
+		flags.numNodes,
+		flags.numFloors,
+		NUM_BUTTONS,
+		flags.doorOpenDuration,
+		flags.travelTime,
 	)
 
-	assignTx := make(chan types.Msg[types.Assign])
-	assignRx := make(chan types.Msg[types.Assign])
-	assignTxSecure := make(chan types.Msg[types.Assign])
+	elevConfig.HallLightGuarantee = flags.hallLightGuarantee
+	elevConfig.OfflinePolicy = flags.offlinePolicy
+	elevConfig.MaintenanceFloor = flags.maintenanceFloor
+	elevConfig.MaintenancePolicy = flags.maintenancePolicy
+	elevConfig.RecallFloor = flags.recallFloor
+	elevConfig.ServedFloors = flags.servedFloors
+	elevConfig.Capacity = flags.capacity
 
-	assignSetRecipient := make(chan int)
-	assignReplyReceived := make(chan string)
+	dispatcher := flags.dispatcher
 
-	go network.SecureTransmitter[types.Assign](
-		assignSetRecipient,
-		assignReplyReceived,
-		assignTx,
-		assignTxSecure,
-	)
+	events.SetNodeID(elevConfig.NodeID)
 
-	servedTx := make(chan types.Msg[types.Served])
-	servedRx := make(chan types.Msg[types.Served])
-	servedTxSecure := make(chan types.Msg[types.Served])
+	travelModel := calib.New(elevConfig, elevConfig.TravelTime)
 
-	servedSetRecipient := make(chan int)
-	servedReplyReceived := make(chan string)
+	kpiRecorder := kpi.New()
 
-	go network.SecureTransmitter[types.Served](
-		servedSetRecipient,
-		servedReplyReceived,
-		servedTx,
-		servedTxSecure,
-	)
-
-	syncTx := make(chan types.Msg[types.Sync])
-	syncRx := make(chan types.Msg[types.Sync])
-	syncTxSecure := make(chan types.Msg[types.Sync])
+	parkingPlanner := parking.New(flags.parking)
 
-	syncSetRecipient := make(chan int)
-	syncReplyReceived := make(chan string)
+	/*
+	 * Cars of the census chunks which have completed the ring
+	 */
+	censusCars := make([]types.CarState, elevConfig.NumNodes)
 
-	go network.SecureTransmitter[types.Sync](
-		syncSetRecipient,
-		syncReplyReceived,
-		syncTx,
-		syncTxSecure,
-	)
+	elevState := elev.InitState(elevConfig)
 
-	go bcast.Transmitter(BCAST_PORT, bidTx, assignTx, servedTx, syncTx)
-	go bcast.Receiver(BCAST_PORT, bidRx, assignRx, servedRx, syncRx)
+	io := setup(flags, elevState, elevConfig)
+
+	drvButtons, drvFloors, drvObstr, drvStop := io.drvButtons, io.drvFloors, io.drvObstr, io.drvStop
+	drvDoorClose, drvLoad := io.drvDoorClose, io.drvLoad
+	apiRequests, blinkDone, statusTx, statusRx := io.apiRequests, io.blinkDone, io.statusTx, io.statusRx
+
+	doorTimeout, doorTimer := io.newTimer("door", time.Duration(elevConfig.DoorOpenDuration) * time.Millisecond)
+	obstrTimeout, obstrTimer := io.newTimer("obstr", DOOR_OBSTR_TIMEOUT * time.Millisecond)
+	floorTimeout, floorTimer := io.newTimer("floor", FLOOR_ARRIVAL_TIMEOUT * time.Millisecond)
+	reassignTimeout, reassignTimer := io.newTimer("reassign", REASSIGN_PERIOD * time.Millisecond)
+	kpiTimeout, kpiTimer := io.newTimer("kpi", KPI_PERIOD * time.Millisecond)
+	statusTimeout, statusTimer := io.newTimer("status", STATUS_PERIOD * time.Millisecond)
+	parkTimeout, parkTimer := io.newTimer("park", PARK_PERIOD * time.Millisecond)
+	modeTimeout, modeTimer := io.newTimer("mode", MODE_PERIOD * time.Millisecond)
+	pruneTimeout, pruneTimer := io.newTimer("prune", PRUNE_PERIOD * time.Millisecond)
+	calibTimeout, calibTimer := io.newTimer("calib", CALIB_PERIOD * time.Millisecond)
+
+	bidTx, bidTxSecure, bidRx := io.bid.tx, io.bid.txSecure, io.bid.rx
+	bidSetRecipient, bidReplyReceived := io.bid.setRecipient, io.bid.replyReceived
+
+	assignTx, assignTxSecure, assignRx := io.assign.tx, io.assign.txSecure, io.assign.rx
+	assignSetRecipient, assignReplyReceived := io.assign.setRecipient, io.assign.replyReceived
+
+	servedTx, servedTxSecure, servedRx := io.served.tx, io.served.txSecure, io.served.rx
+	servedSetRecipient, servedReplyReceived := io.served.setRecipient, io.served.replyReceived
+
+	syncTx, syncTxSecure, syncRx := io.sync.tx, io.sync.txSecure, io.sync.rx
+	syncSetRecipient, syncReplyReceived := io.sync.setRecipient, io.sync.replyReceived
+
+	censusTx, censusTxSecure, censusRx := io.census.tx, io.census.txSecure, io.census.rx
+	censusSetRecipient, censusReplyReceived := io.census.setRecipient, io.census.replyReceived
+
+	reassignTx, reassignTxSecure, reassignRx := io.reassign.tx, io.reassign.txSecure, io.reassign.rx
+	reassignSetRecipient, reassignReplyReceived := io.reassign.setRecipient, io.reassign.replyReceived
+
+	fireTx, fireTxSecure, fireRx := io.fire.tx, io.fire.txSecure, io.fire.rx
+	fireSetRecipient, fireReplyReceived := io.fire.setRecipient, io.fire.replyReceived
+
+	modeTx, modeTxSecure, modeRx := io.mode.tx, io.mode.txSecure, io.mode.rx
+	modeSetRecipient, modeReplyReceived := io.mode.setRecipient, io.mode.replyReceived
+
+	initialFloor := elev.Drv.GetFloor()
+
+	io.journal.Record(journal.JK_Start, journal.Start{
+		NodeID:             flags.nodeID,
+		NumNodes:           flags.numNodes,
+		NumFloors:          flags.numFloors,
+		HallLightGuarantee: flags.hallLightGuarantee,
+		OfflinePolicy:      int(flags.offlinePolicy),
+		Dispatch:           flags.dispatchStrategy,
+		MaintenanceFloor:   flags.maintenanceFloor,
+		MaintenancePolicy:  int(flags.maintenancePolicy),
+		Maintenance:        flags.maintenance,
+		RecallFloor:        flags.recallFloor,
+		ServedFloors:       flags.servedFloors,
+		TravelTime:         flags.travelTime,
+		DoorOpenDuration:   flags.doorOpenDuration,
+		Capacity:           flags.capacity,
+		ParkStrategy:       int(flags.parking.Strategy),
+		HomeFloor:          flags.parking.HomeFloor,
+		ParkAfter:          flags.parking.IdleTime,
+		Lobby:              flags.parking.Lobby,
+		LobbyFrom:          flags.parking.LobbyFrom,
+		LobbyTo:            flags.parking.LobbyTo,
+		Calendar:           flags.calendarSpec,
+		InitialFloor:       initialFloor,
+	})
 
 	/*
 	 * In case we start between two floors; choose a direction
 	 */
-	if 0 > elevio.GetFloor() {
-		elevio.SetMotorDirection(elevio.MD_Down)
+	if 0 > initialFloor {
+		elev.Drv.SetMotorDirection(elevio.MD_Down)
 		elevState.Dirn = elevio.MD_Down
 		fsm.OnInitBetweenFloors()
 		floorTimer <- types.START
@@ -121,10 +214,16 @@ func main() {
 	 */
 	newFloor := <-drvFloors
 
+	io.journal.Record(journal.JK_Floor, newFloor)
+
 	oldFloor := elevState.Floor
 
 	elevState.Floor = newFloor
-	elevio.SetFloorIndicator(newFloor)
+	elevState.FloorArrivedAt = clock.Now().UnixMilli()
+	metrics.Floor.Set(int64(newFloor))
+	elev.Drv.SetFloorIndicator(newFloor)
+
+	travelModel.OnFloorArrival(newFloor)
 
 	floorTimer <- types.STOP
 	elevState.StuckBetweenFloors = false
@@ -137,6 +236,7 @@ func main() {
 		fsmOutput,
 		doorTimer,
 		floorTimer,
+		travelModel,
 	)
 
 	elevState = elev.ClearOrdersAtFloor(
@@ -150,17 +250,58 @@ func main() {
 		floorTimer <- types.START
 	}
 
+	/*
+	 * Started at a floor the car does not serve: move to a served floor,
+	 * or park before joining the ring if started in maintenance mode
+	 */
+	if flags.maintenance || !orders.Serves(elevConfig.ServedFloors, elevState.Floor) {
+		if flags.maintenance {
+			elevState = elev.SetInService(elevState, elevConfig, false, bidTxSecure)
+		}
+
+		fsmOutput := fsm.OnServiceChanged(elevState, elevConfig)
+
+		elevState = elev.SetState(
+			elevState,
+			elevConfig,
+			fsmOutput,
+			doorTimer,
+			floorTimer,
+			travelModel,
+		)
+
+		elevState = elev.ClearOrdersAtFloor(
+			elevState,
+			elevConfig,
+			fsmOutput.ClearOrders,
+			servedTxSecure,
+		)
+	}
+
 	/*
 	 * After setup is complete: start "I'm alive" broadcasting
 	 */
-	peerUpdate := make(chan peers.PeerUpdate)
+	peerUpdate := io.peerUpdate
+
+	io.startPeers()
 
-	go peers.Transmitter(PEER_PORT, strconv.Itoa(elevConfig.NodeID), nil)
-	go peers.Receiver(PEER_PORT, peerUpdate)
+	var livePeers []string
+
+	reassignTimer <- types.START
+	kpiTimer <- types.START
+	statusTimer <- types.START
+	parkTimer <- types.START
+	modeTimer <- types.START
+	pruneTimer <- types.START
+	calibTimer <- types.START
 
 	for {
+		io.journal.Step()
+
 		select {
 		case newPeerList := <-peerUpdate:
+			io.journal.Record(journal.JK_Peers, newPeerList)
+
 			oldNextNodeID := elevState.NextNodeID
 
 			elevState = elev.SetNextNodeID(
@@ -169,13 +310,34 @@ func main() {
 				newPeerList.Peers,
 			)
 
-			printNextNode(elevState, elevConfig)
+			slog.Info("Peers changed",
+				"peers", newPeerList.Peers,
+				"new", newPeerList.New,
+				"lost", newPeerList.Lost,
+				"next", elevState.NextNodeID,
+			)
+
+			if len(newPeerList.New) > 0 {
+				events.Publish(events.EV_PeerNew, newPeerList.New)
+			}
+
+			for _, peer := range newPeerList.Lost {
+				events.Publish(events.EV_PeerLost, peer)
+			}
+
+			metrics.Peers.Set(int64(len(newPeerList.Peers)))
 
 			if elevState.NextNodeID != oldNextNodeID {
+				events.Publish(events.EV_NextNodeChanged, elevState.NextNodeID)
+
 				bidSetRecipient <- elevState.NextNodeID
 				assignSetRecipient <- elevState.NextNodeID
 				servedSetRecipient <- elevState.NextNodeID
 				syncSetRecipient <- elevState.NextNodeID
+				censusSetRecipient <- elevState.NextNodeID
+				reassignSetRecipient <- elevState.NextNodeID
+				fireSetRecipient <- elevState.NextNodeID
+				modeSetRecipient <- elevState.NextNodeID
 			}
 
 			shouldSendSync := elev.ShouldSendSync(
@@ -189,12 +351,14 @@ func main() {
 			disconnected := elevState.NextNodeID == -1
 
 			if shouldSendSync {
-				syncTxSecure <- network.FormatSyncMsg(
+				for _, msg := range network.FormatSyncMsgs(
 					elevState.Orders,
 					elevState.NextNodeID,
 					elevState.NextNodeID,
 					elevConfig.NodeID,
-				)
+				) {
+					syncTxSecure <- msg
+				}
 			} else if oldNextDied && !disconnected {
 				elev.ReassignOrders(
 					elevState,
@@ -204,21 +368,449 @@ func main() {
 				)
 			}
 
-		case newOrder := <-drvButtons:
-			isCabOrder := newOrder.Button == elevio.BT_Cab
+			/*
+			 * Cars joining during a fire recall are recalled as well
+			 */
+			isAlone := elevState.NextNodeID == elevConfig.NodeID
+
+			if elevState.FireRecall && len(newPeerList.New) > 0 && !isAlone && !disconnected {
+				fireTxSecure <- network.FormatFireMsg(
+					true,
+					elevState.NextNodeID,
+					elevConfig.NodeID,
+				)
+			}
+
+			livePeers = newPeerList.Peers
+
+			/*
+			 * Cars joining or leaving may change the best assignment of every hall order
+			 */
+			membershipChanged := len(newPeerList.New) > 0 || len(newPeerList.Lost) > 0
+
+			if membershipChanged && !disconnected && elev.IsCoordinator(elevConfig, livePeers) {
+				for _, msg := range network.FormatCensusMsgs(
+					elevConfig.NumNodes,
+					NUM_FLOORS,
+					elevState.NextNodeID,
+					elevConfig.NodeID,
+				) {
+					censusTxSecure <- msg
+				}
+			}
+
+			/*
+			 * Cars joining the ring are told the traffic mode
+			 */
+			if len(newPeerList.New) > 0 && !isAlone && !disconnected && elev.IsCoordinator(elevConfig, livePeers) {
+				modeTxSecure <- network.FormatModeMsg(
+					elevState.TrafficMode,
+					elevState.NextNodeID,
+					elevConfig.NodeID,
+				)
+			}
+
+		case <-reassignTimeout:
+			io.journal.Record(journal.JK_Timeout, journal.Timeout{Timer: "reassign"})
+
+			reassignTimer <- types.START
+
+			disconnected := elevState.NextNodeID == -1
+
+			if !disconnected && elev.IsCoordinator(elevConfig, livePeers) {
+				for _, msg := range network.FormatCensusMsgs(
+					elevConfig.NumNodes,
+					NUM_FLOORS,
+					elevState.NextNodeID,
+					elevConfig.NodeID,
+				) {
+					censusTxSecure <- msg
+				}
+			}
+
+		case <-kpiTimeout:
+			io.journal.Record(journal.JK_Timeout, journal.Timeout{Timer: "kpi"})
+
+			kpiTimer <- types.START
+
+			kpiRecorder.Collect(elevState.Orders)
+
+			if len(flags.kpiReport) > 0 {
+				err := kpiRecorder.Report(elevConfig).Write(flags.kpiReport)
+
+				if err != nil {
+					slog.Error("Could not write KPI report", "err", err)
+				}
+			}
+
+		case <-calibTimeout:
+			io.journal.Record(journal.JK_Timeout, journal.Timeout{Timer: "calib"})
+
+			calibTimer <- types.START
+
+			if len(flags.calibReport) > 0 {
+				err := travelModel.WriteReport(flags.calibReport)
+
+				if err != nil {
+					slog.Error("Could not write calibration report", "err", err)
+				}
+			}
+
+		case <-pruneTimeout:
+			io.journal.Record(journal.JK_Timeout, journal.Timeout{Timer: "prune"})
+
+			pruneTimer <- types.START
+
+			orders.Prune(elevState.Orders, elevConfig.NumNodes, elevConfig.NodeID)
+
+			isAlone := elevState.NextNodeID == elevConfig.NodeID
+			disconnected := elevState.NextNodeID == -1
+
+			/*
+			 * Served and cancelled orders are sent around the ring
+			 * until every node is known to hold them
+			 */
+			if !isAlone && !disconnected && orders.HasUnheld(elevState.Orders, elevConfig.NumNodes, elevConfig.NodeID) {
+				for _, msg := range network.FormatSyncMsgs(
+					elevState.Orders,
+					-1,
+					elevState.NextNodeID,
+					elevConfig.NodeID,
+				) {
+					syncTxSecure <- msg
+				}
+			}
+
+		case <-statusTimeout:
+			io.journal.Record(journal.JK_Timeout, journal.Timeout{Timer: "status"})
+
+			statusTimer <- types.START
+
+			statusTx <- elev.GetCarStatus(elevState, elevConfig, fsm.Behaviour())
+
+		case status := <-statusRx:
+			if status.NodeID == elevConfig.NodeID {
+				continue
+			}
+
+			io.journal.Record(journal.JK_Status, status)
+
+			parkingPlanner.OnStatus(status)
+
+		case <-modeTimeout:
+			io.journal.Record(journal.JK_Timeout, journal.Timeout{Timer: "mode"})
+
+			modeTimer <- types.START
+
+			/*
+			 * The coordinator switches the mode of the group on its calendar
+			 */
+			mode := flags.calendar.ModeAt(clock.Now())
+
+			if mode == elevState.TrafficMode || !elev.IsCoordinator(elevConfig, livePeers) {
+				continue
+			}
+
+			elevState = elev.SetTrafficMode(elevState, elevConfig, mode, bidTxSecure)
 
 			isAlone := elevState.NextNodeID == elevConfig.NodeID
 			disconnected := elevState.NextNodeID == -1
 
-			if (isAlone || disconnected) && isCabOrder {
-				elevState = elev.SetOrderStatus(
+			if !isAlone && !disconnected {
+				modeTxSecure <- network.FormatModeMsg(
+					mode,
+					elevState.NextNodeID,
+					elevConfig.NodeID,
+				)
+			}
+
+		case <-parkTimeout:
+			io.journal.Record(journal.JK_Timeout, journal.Timeout{Timer: "park"})
+
+			parkTimer <- types.START
+
+			/*
+			 * At night every car but the coordinator powers down once parked
+			 */
+			parked := fsm.Behaviour() == types.EB_Idle && elevState.ParkingFloor == elevState.Floor
+			nightShift := elevState.TrafficMode == types.TM_Night && !elev.IsCoordinator(elevConfig, livePeers)
+
+			if nightShift && parked && elev.IsAvailable(elevState) {
+				elevState = elev.SetPoweredDown(elevState, elevConfig, true, bidTxSecure)
+			} else if elevState.PoweredDown && !nightShift {
+				elevState = elev.SetPoweredDown(elevState, elevConfig, false, bidTxSecure)
+			}
+
+			/*
+			 * A car on its way to park is still idle
+			 */
+			idle := fsm.Behaviour() == types.EB_Idle || elevState.ParkingFloor >= 0
+			idle = idle && elev.IsAvailable(elevState)
+
+			parkingFloor := parkingPlanner.Choose(elevState, elevConfig, idle)
+
+			if parkingFloor == elevState.ParkingFloor {
+				continue
+			}
+
+			slog.Info("Parking floor changed", "from", elevState.ParkingFloor, "to", parkingFloor)
+
+			elevState.ParkingFloor = parkingFloor
+
+			if parkingFloor < 0 || fsm.Behaviour() != types.EB_Idle {
+				continue
+			}
+
+			fsmOutput := fsm.OnServiceChanged(elevState, elevConfig)
+
+			elevState = elev.SetState(
+				elevState,
+				elevConfig,
+				fsmOutput,
+				doorTimer,
+				floorTimer,
+				travelModel,
+			)
+
+			elevState = elev.ClearOrdersAtFloor(
+				elevState,
+				elevConfig,
+				fsmOutput.ClearOrders,
+				servedTxSecure,
+			)
+
+		case request := <-apiRequests:
+			io.journal.Record(journal.JK_Api, journal.ApiRequest{
+				Kind:        int(request.Kind),
+				InService:   request.InService,
+				Independent: request.Independent,
+				Recall:      request.Recall,
+				FireService: request.FireService,
+			})
+
+			isAlone := elevState.NextNodeID == elevConfig.NodeID
+			disconnected := elevState.NextNodeID == -1
+
+			switch request.Kind {
+			case api.RQ_Status:
+				request.Reply <- api.Reply{
+					Status: nodeStatus(elevState, elevConfig, livePeers),
+				}
+
+			case api.RQ_SetInService:
+				slog.Info("Service changed by API", "inService", request.InService)
+
+				elevState = elev.SetInService(
+					elevState,
+					elevConfig,
+					request.InService,
+					bidTxSecure,
+				)
+
+				fsmOutput := fsm.OnServiceChanged(elevState, elevConfig)
+
+				elevState = elev.SetState(
+					elevState,
+					elevConfig,
+					fsmOutput,
+					doorTimer,
+					floorTimer,
+					travelModel,
+				)
+
+				elevState = elev.ClearOrdersAtFloor(
+					elevState,
+					elevConfig,
+					fsmOutput.ClearOrders,
+					servedTxSecure,
+				)
+
+				request.Reply <- api.Reply{}
+
+			case api.RQ_SetIndependent:
+				slog.Info("Independent service changed by API", "independent", request.Independent)
+
+				elevState = elev.SetIndependentService(
+					elevState,
+					elevConfig,
+					request.Independent,
+					bidTxSecure,
+				)
+
+				fsmOutput := fsm.OnServiceChanged(elevState, elevConfig)
+
+				elevState = elev.SetState(
+					elevState,
+					elevConfig,
+					fsmOutput,
+					doorTimer,
+					floorTimer,
+					travelModel,
+				)
+
+				elevState = elev.ClearOrdersAtFloor(
+					elevState,
+					elevConfig,
+					fsmOutput.ClearOrders,
+					servedTxSecure,
+				)
+
+				request.Reply <- api.Reply{}
+
+			case api.RQ_FireRecall:
+				elevState = elev.SetFireRecall(
+					elevState,
+					elevConfig,
+					request.Recall,
+				)
+
+				fsmOutput := fsm.OnServiceChanged(elevState, elevConfig)
+
+				elevState = elev.SetState(
+					elevState,
+					elevConfig,
+					fsmOutput,
+					doorTimer,
+					floorTimer,
+					travelModel,
+				)
+
+				elevState = elev.ClearOrdersAtFloor(
+					elevState,
+					elevConfig,
+					fsmOutput.ClearOrders,
+					servedTxSecure,
+				)
+
+				if !isAlone && !disconnected {
+					fireTxSecure <- network.FormatFireMsg(
+						request.Recall,
+						elevState.NextNodeID,
+						elevConfig.NodeID,
+					)
+				}
+
+				request.Reply <- api.Reply{}
+
+			case api.RQ_FireService:
+				var err error
+
+				elevState, err = elev.SetFireService(
+					elevState,
+					elevConfig,
+					request.FireService,
+				)
+
+				if err != nil {
+					request.Reply <- api.Reply{Err: err}
+					continue
+				}
+
+				io.pollDoorClose(elevState.FireService)
+
+				fsmOutput := fsm.OnServiceChanged(elevState, elevConfig)
+
+				elevState = elev.SetState(
+					elevState,
+					elevConfig,
+					fsmOutput,
+					doorTimer,
+					floorTimer,
+					travelModel,
+				)
+
+				elevState = elev.ClearOrdersAtFloor(
 					elevState,
 					elevConfig,
+					fsmOutput.ClearOrders,
+					servedTxSecure,
+				)
+
+				request.Reply <- api.Reply{}
+
+			case api.RQ_Resync:
+				if isAlone || disconnected {
+					request.Reply <- api.Reply{Err: errors.New("node is not connected to other nodes")}
+					continue
+				}
+
+				for _, msg := range network.FormatSyncMsgs(
+					elevState.Orders,
 					elevConfig.NodeID,
+					elevState.NextNodeID,
+					elevConfig.NodeID,
+				) {
+					syncTxSecure <- msg
+				}
+
+				request.Reply <- api.Reply{}
+			}
+
+		case button := <-drvButtons:
+			io.journal.Record(journal.JK_Button, button)
+
+			events.Publish(events.EV_ButtonPressed, button)
+			slog.Debug("Button pressed", "floor", button.Floor, "button", button.Button)
+
+			if orders.HasPending(elevState.Orders, button, elevConfig.NodeID) {
+				continue
+			}
+
+			/*
+			 * No calls are taken on a fire recall, except cab calls in fire service
+			 */
+			isFireServiceCall := elevState.FireService && button.Button == elevio.BT_Cab
+
+			if elevState.FireRecall && !isFireServiceCall {
+				continue
+			}
+
+			isAlone := elevState.NextNodeID == elevConfig.NodeID
+			disconnected := elevState.NextNodeID == -1
+
+			/*
+			 * Hall calls at floors the car does not serve are left to the
+			 * other cars, and rejected when there are none
+			 */
+			isCabOrder := button.Button == elevio.BT_Cab
+			servesFloor := orders.Serves(elevConfig.ServedFloors, button.Floor)
+
+			if !servesFloor && (isCabOrder || isAlone || disconnected) {
+				io.blinkButtonLamp(button, blinkDone)
+				continue
+			}
+
+			if elevState.PoweredDown && button.Button == elevio.BT_Cab {
+				elevState = elev.SetPoweredDown(elevState, elevConfig, false, bidTxSecure)
+			}
+
+			dropsCabOrders := elevConfig.MaintenancePolicy == types.MP_Drop
+
+			if button.Button == elevio.BT_Cab && elevState.OutOfService && dropsCabOrders {
+				continue
+			}
+
+			newOrder := orders.New(button, elevConfig.NodeID)
+
+			acceptOffline := disconnected && !isCabOrder && elevConfig.OfflinePolicy == types.OP_Serve
+
+			if ((isAlone || disconnected) && isCabOrder) || acceptOffline {
+				elevState = elev.AssignOrder(
+					elevState,
+					elevConfig,
 					newOrder,
-					true,
+					elevConfig.NodeID,
 				)
 
+				/*
+				 * We are the only live node, so the order is acknowledged.
+				 * It is handed over to the ring when we rejoin.
+				 */
+				if acceptOffline {
+					elevState = elev.AcknowledgeOrder(elevState, elevConfig, newOrder)
+					elevState.PendingHandover = true
+				}
+
 				fsmOutput := fsm.OnOrderAssigned(newOrder, elevState, elevConfig)
 
 				elevState = elev.SetState(
@@ -227,6 +819,7 @@ func main() {
 					fsmOutput,
 					doorTimer,
 					floorTimer,
+					travelModel,
 				)
 
 				elevState = elev.ClearOrdersAtFloor(
@@ -236,6 +829,8 @@ func main() {
 					servedTxSecure,
 				)
 			} else if !isAlone && !disconnected && isCabOrder {
+				elevState = elev.AddOrder(elevState, elevConfig, newOrder)
+
 				assignTxSecure <- network.FormatAssignMsg(
 					newOrder,
 					elevConfig.NodeID,
@@ -244,6 +839,10 @@ func main() {
 					elevConfig.NodeID,
 				)
 			} else if !disconnected {
+				elevState = elev.AddOrder(elevState, elevConfig, newOrder)
+
+				metrics.BidsSent.Inc()
+
 				bidTxSecure <- network.FormatBidMsg(
 					nil,
 					newOrder,
@@ -252,13 +851,94 @@ func main() {
 					elevState.NextNodeID,
 					elevConfig.NodeID,
 				)
+			} else {
+				io.blinkButtonLamp(button, blinkDone)
 			}
 
+		case keySwitch := <-drvStop:
+			io.journal.Record(journal.JK_KeySwitch, keySwitch)
+
+			/*
+			 * Every press of the stop button turns the key switch
+			 */
+			if !keySwitch {
+				continue
+			}
+
+			slog.Info("Service changed by key switch", "inService", elevState.OutOfService)
+
+			elevState = elev.SetInService(
+				elevState,
+				elevConfig,
+				elevState.OutOfService,
+				bidTxSecure,
+			)
+
+			fsmOutput := fsm.OnServiceChanged(elevState, elevConfig)
+
+			elevState = elev.SetState(
+				elevState,
+				elevConfig,
+				fsmOutput,
+				doorTimer,
+				floorTimer,
+				travelModel,
+			)
+
+			elevState = elev.ClearOrdersAtFloor(
+				elevState,
+				elevConfig,
+				fsmOutput.ClearOrders,
+				servedTxSecure,
+			)
+
+		case load := <-drvLoad:
+			io.journal.Record(journal.JK_Load, load)
+
+			elevState = elev.SetLoad(elevState, elevConfig, load, bidTxSecure)
+
+			fsmOutput := fsm.OnServiceChanged(elevState, elevConfig)
+
+			elevState = elev.SetState(
+				elevState,
+				elevConfig,
+				fsmOutput,
+				doorTimer,
+				floorTimer,
+				travelModel,
+			)
+
+			elevState = elev.ClearOrdersAtFloor(
+				elevState,
+				elevConfig,
+				fsmOutput.ClearOrders,
+				servedTxSecure,
+			)
+
+		case held := <-drvDoorClose:
+			io.journal.Record(journal.JK_DoorClose, held)
+
+			elevState.DoorCloseHeld = held && elevState.FireService
+
+		case <-blinkDone:
+			io.journal.Record(journal.JK_Blink, nil)
+
+			elev.SetHallLights(elevState.Orders, elevConfig)
+
 		case newFloor := <-drvFloors:
+			io.journal.Record(journal.JK_Floor, newFloor)
+
 			oldFloor := elevState.Floor
 
 			elevState.Floor = newFloor
-			elevio.SetFloorIndicator(newFloor)
+			elevState.FloorArrivedAt = clock.Now().UnixMilli()
+			metrics.Floor.Set(int64(newFloor))
+			events.Publish(events.EV_FloorArrival, newFloor)
+			slog.Debug("Arrived at floor", "floor", newFloor)
+			elev.Drv.SetFloorIndicator(newFloor)
+
+			travelModel.OnFloorArrival(newFloor)
+			elevState.TravelTimes = travelModel.TravelTimes()
 
 			floorTimer <- types.STOP
 			elevState.StuckBetweenFloors = false
@@ -271,6 +951,7 @@ func main() {
 				fsmOutput,
 				doorTimer,
 				floorTimer,
+				travelModel,
 			)
 
 			elevState = elev.ClearOrdersAtFloor(
@@ -285,11 +966,14 @@ func main() {
 			}
 
 		case isObstructed := <-drvObstr:
+			io.journal.Record(journal.JK_Obstr, isObstructed)
+
 			if elevState.DoorObstr == isObstructed {
 				continue
 			}
 
 			if isObstructed {
+				metrics.ObstructionEvents.Inc()
 				obstrTimer <- types.START
 			} else {
 				obstrTimer <- types.STOP
@@ -298,8 +982,13 @@ func main() {
 			doorTimer <- types.START
 			elevState.DoorObstr = isObstructed
 
+			events.Publish(events.EV_Obstruction, isObstructed)
+			slog.Info("Obstruction changed", "obstructed", isObstructed)
+
 
 		case <-doorTimeout:
+			io.journal.Record(journal.JK_Timeout, journal.Timeout{Timer: "door"})
+
 			if elevState.DoorObstr {
 				doorTimer <- types.START
 				continue
@@ -314,6 +1003,7 @@ func main() {
 				fsmOutput,
 				doorTimer,
 				floorTimer,
+				travelModel,
 			)
 
 			elevState = elev.ClearOrdersAtFloor(
@@ -324,8 +1014,12 @@ func main() {
 			)
 
 		case <-obstrTimeout:
+			io.journal.Record(journal.JK_Timeout, journal.Timeout{Timer: "obstr"})
+
 			obstrTimer <- types.STOP
 
+			slog.Warn("Door obstructed for too long, handing over hall orders")
+
 			disconnected := elevState.NextNodeID == -1
 
 			if disconnected {
@@ -340,7 +1034,11 @@ func main() {
 			)
 
 		case <-floorTimeout:
+			io.journal.Record(journal.JK_Timeout, journal.Timeout{Timer: "floor"})
+
 			elevState.StuckBetweenFloors = true
+			metrics.StuckEvents.Inc()
+			slog.Warn("Did not reach a floor in time, handing over hall orders", "floor", elevState.Floor)
 
 			disconnected := elevState.NextNodeID == -1
 
@@ -360,10 +1058,19 @@ func main() {
 				continue
 			}
 
+			logReceived("bid", bid.Header)
+			io.journal.Record(journal.JK_Bid, bid)
+			bid.Header = trace.Received("bid", bid.Header)
+
 			isReply := bid.Header.AuthorID == elevConfig.NodeID
 
-			if !elevState.DoorObstr && !elevState.StuckBetweenFloors {
-				bid.Content.TimeToServed[elevConfig.NodeID] = fsm.TimeToOrderServed(
+			/*
+			 * The car never bids on a floor it does not serve
+			 */
+			servesFloor := orders.Serves(elevConfig.ServedFloors, bid.Content.Order.Floor)
+
+			if elev.IsAvailable(elevState) && servesFloor {
+				bid.Content.TimeToServed[elevConfig.NodeID] = dispatcher.Cost(
 					elevState,
 					elevConfig,
 					bid.Content.Order,
@@ -377,7 +1084,27 @@ func main() {
 			} else {
 				bidReplyReceived <- bid.Header.UUID
 
-				assignee := minTimeToServed(bid.Content.TimeToServed)
+				assignee := dispatcher.Choose(bid.Content.TimeToServed)
+
+				/*
+				 * A new order no car can serve is rejected,
+				 * a reassigned one is left with its car
+				 */
+				if 0 > assignee {
+					isNewOrder := bid.Content.OldAssignee == int(types.UNASSIGNED)
+
+					if isNewOrder {
+						elevState = elev.RejectOrder(elevState, elevConfig, bid.Content.Order)
+						io.blinkButtonLamp(bid.Content.Order.ButtonEvent, blinkDone)
+					} else {
+						slog.Warn("No car can serve the order, left with its car",
+							"order", bid.Content.Order.ID,
+							"assignee", bid.Content.OldAssignee,
+						)
+					}
+
+					continue
+				}
 
 				assignTxSecure <- network.FormatAssignMsg(
 					bid.Content.Order,
@@ -393,24 +1120,25 @@ func main() {
 				continue
 			}
 
-			if assign.Content.OldAssignee != int(types.UNASSIGNED) {
-				elevState = elev.SetOrderStatus(
+			logReceived("assign", assign.Header)
+			io.journal.Record(journal.JK_Assign, assign)
+			assign.Header = trace.Received("assign", assign.Header)
+
+			if assign.Content.Acknowledged {
+				elevState = elev.AcknowledgeOrder(
 					elevState,
 					elevConfig,
-					assign.Content.OldAssignee,
 					assign.Content.Order,
-					false,
+				)
+			} else {
+				elevState = elev.AssignOrder(
+					elevState,
+					elevConfig,
+					assign.Content.Order,
+					assign.Content.NewAssignee,
 				)
 			}
 
-			elevState = elev.SetOrderStatus(
-				elevState,
-				elevConfig,
-				assign.Content.NewAssignee,
-				assign.Content.Order,
-				true,
-			)
-
 			isReply := assign.Header.AuthorID == elevConfig.NodeID
 
 			if !isReply && assign.Header.LoopCounter < elevConfig.NumNodes {
@@ -421,10 +1149,31 @@ func main() {
 				assignReplyReceived <- assign.Header.UUID
 			}
 
+			if assign.Content.Acknowledged {
+				continue
+			}
+
+			/*
+			 * The assignment has been around the ring,
+			 * so every live node knows about the order
+			 */
+			if isReply {
+				assignTxSecure <- network.FormatAckMsg(
+					assign.Content.Order,
+					assign.Content.NewAssignee,
+					elevState.NextNodeID,
+					elevConfig.NodeID,
+				)
+			}
+
 			if assign.Content.NewAssignee != elevConfig.NodeID {
 				continue
 			}
 
+			if assign.Content.Order.Button != elevio.BT_Cab {
+				metrics.BidsWon.Inc()
+			}
+
 			fsmOutput := fsm.OnOrderAssigned(
 				assign.Content.Order,
 				elevState,
@@ -437,6 +1186,7 @@ func main() {
 				fsmOutput,
 				doorTimer,
 				floorTimer,
+				travelModel,
 			)
 
 			elevState = elev.ClearOrdersAtFloor(
@@ -451,12 +1201,14 @@ func main() {
 				continue
 			}
 
-			elevState = elev.SetOrderStatus(
+			logReceived("served", served.Header)
+			io.journal.Record(journal.JK_Served, served)
+			served.Header = trace.Received("served", served.Header)
+
+			elevState = elev.ServeOrder(
 				elevState,
 				elevConfig,
-				served.Header.AuthorID,
 				served.Content.Order,
-				false,
 			)
 
 			isReply := served.Header.AuthorID == elevConfig.NodeID
@@ -474,10 +1226,30 @@ func main() {
 				continue
 			}
 
+			logReceived("sync", sync.Header)
+			io.journal.Record(journal.JK_Sync, sync)
+			sync.Header = trace.Received("sync", sync.Header)
+
+			isReply := sync.Header.AuthorID == elevConfig.NodeID
+
+			/*
+			 * The reply holds the merged order lists of every node in the ring.
+			 * If it differs from ours, some nodes are still missing orders
+			 * and a second round is needed for the ring to converge.
+			 */
+			localOrders, _ := orders.Chunk(
+				elevState.Orders,
+				sync.Content.From,
+				sync.Content.To,
+				elevConfig.NodeID,
+			)
+			upToDate := orders.Equal(localOrders, sync.Content.Orders)
+
 			elevState = elev.MergeOrderLists(
 				elevState,
 				elevConfig,
 				sync.Content.Orders,
+				sync.Content.Tombstones,
 			)
 
 			isTarget := sync.Content.TargetID == elevConfig.NodeID
@@ -491,6 +1263,7 @@ func main() {
 					fsmOutput,
 					doorTimer,
 					floorTimer,
+					travelModel,
 				)
 
 				elevState = elev.ClearOrdersAtFloor(
@@ -501,15 +1274,265 @@ func main() {
 				)
 			}
 
-			isReply := sync.Header.AuthorID == elevConfig.NodeID
+			/*
+			 * Let the ring bid on hall orders accepted while disconnected
+			 */
+			if isTarget && elevState.PendingHandover {
+				elevState.PendingHandover = false
+
+				elev.ReassignOrders(
+					elevState,
+					elevConfig,
+					elevConfig.NodeID,
+					bidTxSecure,
+				)
+			}
 
 			if !isReply && sync.Header.LoopCounter < elevConfig.NumNodes {
 				sync.Header.Recipient = elevState.NextNodeID
 				sync.Header.LoopCounter += 1
-				sync.Content.Orders = elevState.Orders
+
+				forwarded := sync
+				forwarded.Content.Orders, forwarded.Content.Tombstones = orders.Chunk(
+					elevState.Orders,
+					sync.Content.From,
+					sync.Content.To,
+					elevConfig.NodeID,
+				)
+
+				/*
+				 * Orders added here may not fit in the chunk. The chunk is
+				 * passed on as received and the orders go in a round of their own.
+				 */
+				if network.Fits(forwarded) {
+					sync = forwarded
+				} else {
+					slog.Info("Orders do not fit in the sync chunk, starting another round")
+
+					for _, msg := range network.FormatSyncMsgs(
+						elevState.Orders,
+						sync.Content.TargetID,
+						elevState.NextNodeID,
+						elevConfig.NodeID,
+					) {
+						syncTxSecure <- msg
+					}
+				}
+
 				syncTx <- sync
 			} else {
 				syncReplyReceived <- sync.Header.UUID
+
+				isAlone := elevState.NextNodeID == elevConfig.NodeID
+				disconnected := elevState.NextNodeID == -1
+
+				if !upToDate && !isAlone && !disconnected {
+					slog.Info("Order lists differ after sync, starting another round",
+						"from", sync.Content.From,
+					)
+
+					msg := network.FormatSyncChunkMsg(
+						elevState.Orders,
+						sync.Content.From,
+						sync.Content.To,
+						sync.Content.TargetID,
+						elevState.NextNodeID,
+						elevConfig.NodeID,
+					)
+					msgs := []types.Msg[types.Sync]{msg}
+
+					if !network.Fits(msg) {
+						msgs = network.FormatSyncMsgs(
+							elevState.Orders,
+							sync.Content.TargetID,
+							elevState.NextNodeID,
+							elevConfig.NodeID,
+						)
+					}
+
+					for _, msg := range msgs {
+						syncTxSecure <- msg
+					}
+				}
+			}
+
+		case census := <-censusRx:
+			if census.Header.Recipient != elevConfig.NodeID {
+				continue
+			}
+
+			logReceived("census", census.Header)
+			io.journal.Record(journal.JK_Census, census)
+			census.Header = trace.Received("census", census.Header)
+
+			for i, car := range census.Content.Cars {
+				if car.NodeID == elevConfig.NodeID {
+					census.Content.Cars[i] = elev.GetCarState(
+						elevState,
+						elevConfig,
+						fsm.Behaviour(),
+					)
+				}
+			}
+
+			isReply := census.Header.AuthorID == elevConfig.NodeID
+
+			if !isReply && census.Header.LoopCounter < elevConfig.NumNodes {
+				census.Header.Recipient = elevState.NextNodeID
+				census.Header.LoopCounter += 1
+				censusTx <- census
+				continue
+			}
+
+			censusReplyReceived <- census.Header.UUID
+
+			if !isReply {
+				continue
+			}
+
+			for _, car := range census.Content.Cars {
+				censusCars[car.NodeID] = car
+			}
+
+			if !census.Content.Last {
+				continue
+			}
+
+			assignments := orders.ChangedAssignments(
+				elevState.Orders,
+				dispatch.BatchAssign(censusCars, elevState.Orders, elevConfig, elevState.TrafficMode),
+			)
+
+			if len(assignments) > 0 {
+				slog.Info("Reassigning hall orders", "count", len(assignments))
+
+				for _, msg := range network.FormatReassignMsgs(
+					assignments,
+					elevState.NextNodeID,
+					elevConfig.NodeID,
+				) {
+					reassignTxSecure <- msg
+				}
+			}
+
+		case reassign := <-reassignRx:
+			if reassign.Header.Recipient != elevConfig.NodeID {
+				continue
+			}
+
+			logReceived("reassign", reassign.Header)
+			io.journal.Record(journal.JK_Reassign, reassign)
+			reassign.Header = trace.Received("reassign", reassign.Header)
+
+			elevState = elev.ApplyAssignments(
+				elevState,
+				elevConfig,
+				reassign.Content.Assignments,
+			)
+
+			isReply := reassign.Header.AuthorID == elevConfig.NodeID
+
+			if !isReply && reassign.Header.LoopCounter < elevConfig.NumNodes {
+				reassign.Header.Recipient = elevState.NextNodeID
+				reassign.Header.LoopCounter += 1
+				reassignTx <- reassign
+			} else {
+				reassignReplyReceived <- reassign.Header.UUID
+			}
+
+			/*
+			 * A moving car picks up its new orders at the next floor,
+			 * and an open door chooses direction when it closes
+			 */
+			if fsm.Behaviour() != types.EB_Idle {
+				continue
+			}
+
+			fsmOutput := fsm.OnSync(elevState, elevConfig)
+
+			elevState = elev.SetState(
+				elevState,
+				elevConfig,
+				fsmOutput,
+				doorTimer,
+				floorTimer,
+				travelModel,
+			)
+
+			elevState = elev.ClearOrdersAtFloor(
+				elevState,
+				elevConfig,
+				fsmOutput.ClearOrders,
+				servedTxSecure,
+			)
+
+		case fire := <-fireRx:
+			if fire.Header.Recipient != elevConfig.NodeID {
+				continue
+			}
+
+			logReceived("fire", fire.Header)
+			io.journal.Record(journal.JK_Fire, fire)
+			fire.Header = trace.Received("fire", fire.Header)
+
+			elevState = elev.SetFireRecall(
+				elevState,
+				elevConfig,
+				fire.Content.Recall,
+			)
+
+			fsmOutput := fsm.OnServiceChanged(elevState, elevConfig)
+
+			elevState = elev.SetState(
+				elevState,
+				elevConfig,
+				fsmOutput,
+				doorTimer,
+				floorTimer,
+				travelModel,
+			)
+
+			elevState = elev.ClearOrdersAtFloor(
+				elevState,
+				elevConfig,
+				fsmOutput.ClearOrders,
+				servedTxSecure,
+			)
+
+			isReply := fire.Header.AuthorID == elevConfig.NodeID
+
+			if !isReply && fire.Header.LoopCounter < elevConfig.NumNodes {
+				fire.Header.Recipient = elevState.NextNodeID
+				fire.Header.LoopCounter += 1
+				fireTx <- fire
+			} else {
+				fireReplyReceived <- fire.Header.UUID
+			}
+
+		case mode := <-modeRx:
+			if mode.Header.Recipient != elevConfig.NodeID {
+				continue
+			}
+
+			logReceived("mode", mode.Header)
+			io.journal.Record(journal.JK_Mode, mode)
+			mode.Header = trace.Received("mode", mode.Header)
+
+			elevState = elev.SetTrafficMode(
+				elevState,
+				elevConfig,
+				mode.Content.Mode,
+				bidTxSecure,
+			)
+
+			isReply := mode.Header.AuthorID == elevConfig.NodeID
+
+			if !isReply && mode.Header.LoopCounter < elevConfig.NumNodes {
+				mode.Header.Recipient = elevState.NextNodeID
+				mode.Header.LoopCounter += 1
+				modeTx <- mode
+			} else {
+				modeReplyReceived <- mode.Header.UUID
 			}
 
 		default:
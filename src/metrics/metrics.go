@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+ * A counter or gauge in the Prometheus text format.
+ * Metrics with a label hold one value per label value,
+ * the others a single value with an empty label value.
+ */
+type Metric struct {
+	name  string
+	help  string
+	kind  string
+	label string
+
+	lock   sync.Mutex
+	values map[string]*atomic.Int64
+}
+
+var all []*Metric
+
+func newMetric(name string, help string, kind string, label string) *Metric {
+	metric := &Metric{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		label:  label,
+		values: make(map[string]*atomic.Int64),
+	}
+
+	all = append(all, metric)
+
+	return metric
+}
+
+var Floor = newMetric("elevator_floor", "Last floor the car passed", "gauge", "")
+var Direction = newMetric("elevator_direction", "Direction of the car, -1 down, 0 stopped and 1 up", "gauge", "")
+var DoorOpen = newMetric("elevator_door_open", "1 if the door is open", "gauge", "")
+var Load = newMetric("elevator_load_percent", "Load in the car in percent of its rated load", "gauge", "")
+var Orders = newMetric("elevator_orders", "Unserved orders assigned to the car", "gauge", "type")
+var BidsSent = newMetric("elevator_bids_sent_total", "Bids started by the node", "counter", "")
+var BidsWon = newMetric("elevator_bids_won_total", "Hall orders assigned to the car by a bid", "counter", "")
+var QueueDepth = newMetric("elevator_transmit_queue_depth", "Messages waiting for a reply from the ring", "gauge", "msg")
+var Retransmits = newMetric("elevator_retransmits_total", "Messages sent again after no reply", "counter", "msg")
+var Peers = newMetric("elevator_peers", "Live nodes including this one", "gauge", "")
+var ObstructionEvents = newMetric("elevator_obstructions_total", "Times the door was obstructed", "counter", "")
+var StuckEvents = newMetric("elevator_stuck_total", "Times the car did not reach a floor in time", "counter", "")
+
+func (m *Metric) With(labelValue string) *atomic.Int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	value, exists := m.values[labelValue]
+
+	if !exists {
+		value = new(atomic.Int64)
+		m.values[labelValue] = value
+	}
+
+	return value
+}
+
+func (m *Metric) Set(value int64) {
+	m.With("").Store(value)
+}
+
+func (m *Metric) Inc() {
+	m.With("").Add(1)
+}
+
+func (m *Metric) write(builder *strings.Builder) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	fmt.Fprintf(builder, "# HELP %s %s\n", m.name, m.help)
+	fmt.Fprintf(builder, "# TYPE %s %s\n", m.name, m.kind)
+
+	if len(m.values) == 0 && len(m.label) == 0 {
+		fmt.Fprintf(builder, "%s 0\n", m.name)
+		return
+	}
+
+	labelValues := make([]string, 0, len(m.values))
+
+	for labelValue := range m.values {
+		labelValues = append(labelValues, labelValue)
+	}
+
+	slices.Sort(labelValues)
+
+	for _, labelValue := range labelValues {
+		if len(m.label) == 0 {
+			fmt.Fprintf(builder, "%s %d\n", m.name, m.values[labelValue].Load())
+		} else {
+			fmt.Fprintf(builder, "%s{%s=%q} %d\n", m.name, m.label, labelValue, m.values[labelValue].Load())
+		}
+	}
+}
+
+/*
+ * Serves every metric in the Prometheus text format
+ */
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var builder strings.Builder
+
+		for _, metric := range all {
+			metric.write(&builder)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(builder.String()))
+	})
+}
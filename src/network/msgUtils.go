@@ -1,9 +1,13 @@
 package network
 
 import (
+	"Driver-go/elevio"
 	"crypto/rand"
+	"elevator/orders"
 	"elevator/types"
 	"fmt"
+	"log/slog"
+	"slices"
 )
 
 /*
@@ -14,7 +18,7 @@ func pseudo_uuid() (uuid string) {
 	b := make([]byte, 16)
 	_, err := rand.Read(b)
 	if err != nil {
-		fmt.Println("Error: ", err)
+		slog.Error("Could not create message UUID", "err", err)
 		return
 	}
 
@@ -80,6 +84,25 @@ func FormatAssignMsg(
 	return msg
 }
 
+func FormatAckMsg(
+	order types.Order,
+	assignee int,
+	recipient int,
+	author int,
+) types.Msg[types.Assign] {
+	msg := FormatAssignMsg(
+		order,
+		assignee,
+		assignee,
+		recipient,
+		author,
+	)
+
+	msg.Content.Acknowledged = true
+
+	return msg
+}
+
 func FormatServedMsg(
 	order types.Order,
 	recipient int,
@@ -100,22 +123,261 @@ func FormatServedMsg(
 	return msg
 }
 
-func FormatSyncMsg(
-	orders [][][]bool,
+/*
+ * The registry is split in chunks of consecutive order IDs,
+ * each filled up to CHUNK_SIZE
+ */
+func FormatSyncMsgs(
+	registry types.OrderRegistry,
+	syncTarget int,
+	recipient int,
+	author int,
+) []types.Msg[types.Sync] {
+	var msgs []types.Msg[types.Sync]
+
+	ids := make([]string, 0, len(registry))
+
+	for id := range registry {
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+
+	from := ""
+
+	for i := 1; i < len(ids); i++ {
+		to := ""
+
+		if i+1 < len(ids) {
+			to = ids[i+1]
+		}
+
+		if msgSize(FormatSyncChunkMsg(registry, from, to, syncTarget, recipient, author)) <= CHUNK_SIZE {
+			continue
+		}
+
+		msgs = append(msgs, FormatSyncChunkMsg(registry, from, ids[i], syncTarget, recipient, author))
+		from = ids[i]
+	}
+
+	return append(msgs, FormatSyncChunkMsg(registry, from, "", syncTarget, recipient, author))
+}
+
+func FormatSyncChunkMsg(
+	registry types.OrderRegistry,
+	from string,
+	to string,
 	syncTarget int,
 	recipient int,
 	author int,
 ) types.Msg[types.Sync] {
+	unserved, tombstones := orders.Chunk(registry, from, to, author)
+
 	msg := types.Msg[types.Sync]{
+		Header: types.Header{
+			AuthorID:    author,
+			Recipient:   recipient,
+			UUID:        pseudo_uuid(),
+			LoopCounter: 0,
+		},
+		Content: types.Sync{
+			Orders:     unserved,
+			Tombstones: tombstones,
+			From:       from,
+			To:         to,
+			TargetID:   syncTarget,
+		},
+	}
+
+	return msg
+}
+
+/*
+ * The census is split in chunks of cars which fit in a broadcast
+ * whatever the state of each car
+ */
+func FormatCensusMsgs(
+	NumNodes int,
+	NumFloors int,
+	recipient int,
+	author int,
+) []types.Msg[types.Census] {
+	carsPerMsg := NumNodes
+
+	for carsPerMsg > 1 && !Fits(censusMsg(largestCars(carsPerMsg, NumFloors), true, recipient, author)) {
+		carsPerMsg--
+	}
+
+	var msgs []types.Msg[types.Census]
+
+	for first := 0; first < NumNodes; first += carsPerMsg {
+		cars := make([]types.CarState, min(carsPerMsg, NumNodes-first))
+
+		for i := range cars {
+			cars[i] = types.CarState{
+				NodeID: first + i,
+				Floor:  -1,
+			}
+		}
+
+		last := first+carsPerMsg >= NumNodes
+		msgs = append(msgs, censusMsg(cars, last, recipient, author))
+	}
+
+	return msgs
+}
+
+func censusMsg(
+	cars []types.CarState,
+	last bool,
+	recipient int,
+	author int,
+) types.Msg[types.Census] {
+	msg := types.Msg[types.Census]{
+		Header: types.Header{
+			AuthorID:    author,
+			Recipient:   recipient,
+			UUID:        pseudo_uuid(),
+			LoopCounter: 0,
+		},
+		Content: types.Census{
+			Cars: cars,
+			Last: last,
+		},
+	}
+
+	return msg
+}
+
+/*
+ * Cars with every field at its longest
+ */
+func largestCars(numCars int, NumFloors int) []types.CarState {
+	cars := make([]types.CarState, numCars)
+	segments := make([]int, NumFloors-1)
+
+	for i := range segments {
+		segments[i] = 99999
+	}
+
+	for i := range cars {
+		cars[i] = types.CarState{
+			NodeID:    numCars - 1,
+			Floor:     NumFloors - 1,
+			Dirn:      elevio.MD_Down,
+			Behaviour: types.EB_DoorOpen,
+			Travel: types.TravelTimes{
+				Segments:     segments,
+				DoorDwell:    99999,
+				StopOverhead: 99999,
+			},
+			NumFloors:        NumFloors,
+			ServedFloors:     make([]bool, NumFloors),
+			TravelTime:       99999,
+			DoorOpenDuration: 99999,
+			Capacity:         999,
+			Load:             100,
+		}
+	}
+
+	return cars
+}
+
+/*
+ * The assignments are split in chunks which fit in a broadcast,
+ * each chunk can be applied on its own
+ */
+func FormatReassignMsgs(
+	assignments map[string]int,
+	recipient int,
+	author int,
+) []types.Msg[types.Reassign] {
+	var msgs []types.Msg[types.Reassign]
+
+	chunk := reassignMsg(make(map[string]int), recipient, author)
+
+	ids := make([]string, 0, len(assignments))
+
+	for id := range assignments {
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		chunk.Content.Assignments[id] = assignments[id]
+
+		if Fits(chunk) || len(chunk.Content.Assignments) == 1 {
+			continue
+		}
+
+		delete(chunk.Content.Assignments, id)
+		msgs = append(msgs, chunk)
+
+		chunk = reassignMsg(map[string]int{id: assignments[id]}, recipient, author)
+	}
+
+	if len(chunk.Content.Assignments) > 0 {
+		msgs = append(msgs, chunk)
+	}
+
+	return msgs
+}
+
+func reassignMsg(
+	assignments map[string]int,
+	recipient int,
+	author int,
+) types.Msg[types.Reassign] {
+	msg := types.Msg[types.Reassign]{
+		Header: types.Header{
+			AuthorID:    author,
+			Recipient:   recipient,
+			UUID:        pseudo_uuid(),
+			LoopCounter: 0,
+		},
+		Content: types.Reassign{
+			Assignments: assignments,
+		},
+	}
+
+	return msg
+}
+
+func FormatFireMsg(
+	recall bool,
+	recipient int,
+	author int,
+) types.Msg[types.Fire] {
+	msg := types.Msg[types.Fire]{
 		Header: types.Header{
 			AuthorID:  author,
 			Recipient: recipient,
 			UUID:      pseudo_uuid(),
 			LoopCounter: 0,
 		},
-		Content: types.Sync{
-			Orders:   orders,
-			TargetID: syncTarget,
+		Content: types.Fire{
+			Recall: recall,
+		},
+	}
+
+	return msg
+}
+
+func FormatModeMsg(
+	mode types.TrafficMode,
+	recipient int,
+	author int,
+) types.Msg[types.Mode] {
+	msg := types.Msg[types.Mode]{
+		Header: types.Header{
+			AuthorID:  author,
+			Recipient: recipient,
+			UUID:      pseudo_uuid(),
+			LoopCounter: 0,
+		},
+		Content: types.Mode{
+			Mode: mode,
 		},
 	}
 
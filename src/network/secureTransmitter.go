@@ -1,7 +1,12 @@
 package network
 
 import (
+	"elevator/metrics"
+	"elevator/trace"
 	"elevator/types"
+	"log/slog"
+	"reflect"
+	"strings"
 	"time"
 )
 
@@ -21,14 +26,23 @@ func SecureTransmitter[T types.Content](
 
 	var msgBuffer []types.Msg[T]
 
+	msgName := strings.ToLower(reflect.TypeOf(*new(T)).Name())
+	queueDepth := metrics.QueueDepth.With(msgName)
+	retransmits := metrics.Retransmits.With(msgName)
+
 	replyTimeout := time.NewTicker(REPLY_TIMEOUT * time.Millisecond)
 	replyTimeout.Stop()
 
 	for {
 		select {
 		case newRecipient := <-setRecipient:
+			if len(msgBuffer) > 0 {
+				slog.Info("Redirected waiting messages", "msg", msgName, "count", len(msgBuffer), "recipient", newRecipient)
+			}
+
 			for i := range msgBuffer {
 				msgBuffer[i].Header.Recipient = newRecipient
+				trace.Event(msgBuffer[i].Header.UUID, "redirect")
 			}
 
 		case replyId := <-replyReceived:
@@ -39,30 +53,60 @@ func SecureTransmitter[T types.Content](
 			validReply := replyId == msgBuffer[0].Header.UUID
 
 			if !validReply {
+				slog.Debug("Ignored reply to a message not waiting for one", "msg", msgName, "uuid", replyId)
 				continue
 			}
 
+			slog.Debug("Reply received", "msg", msgName, "uuid", replyId)
+			trace.Replied(replyId)
+
 			msgBuffer = msgBuffer[1:]
+			queueDepth.Store(int64(len(msgBuffer)))
 
 			if len(msgBuffer) == 0 {
 				replyTimeout.Stop()
 				continue
 			}
 
+			msgBuffer[0].Header = trace.Transmit(msgBuffer[0].Header, "sent")
 			msgTx <- msgBuffer[0]
 			replyTimeout.Reset(REPLY_TIMEOUT * time.Millisecond)
 
 		case newMsg := <-msg:
+			if !Fits(newMsg) {
+				slog.Error("Dropped message too long to broadcast", "msg", msgName, "uuid", newMsg.Header.UUID)
+				continue
+			}
+
+			trace.Queued(msgName, newMsg.Header)
+
 			msgBuffer = append(msgBuffer, newMsg)
+			queueDepth.Store(int64(len(msgBuffer)))
+
+			slog.Debug("Message queued",
+				"msg", msgName,
+				"uuid", newMsg.Header.UUID,
+				"recipient", newMsg.Header.Recipient,
+				"queued", len(msgBuffer),
+			)
 
 			if len(msgBuffer) == 1 {
+				msgBuffer[0].Header = trace.Transmit(msgBuffer[0].Header, "sent")
 				msgTx <- msgBuffer[0]
 				replyTimeout = time.NewTicker(REPLY_TIMEOUT * time.Millisecond)
 			}
 
 		case <-replyTimeout.C:
 			if len(msgBuffer) > 0 {
+				msgBuffer[0].Header = trace.Transmit(msgBuffer[0].Header, "retransmit")
 				msgTx <- msgBuffer[0]
+				retransmits.Add(1)
+
+				slog.Warn("No reply, message sent again",
+					"msg", msgName,
+					"uuid", msgBuffer[0].Header.UUID,
+					"recipient", msgBuffer[0].Header.Recipient,
+				)
 			}
 		}
 	}
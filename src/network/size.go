@@ -0,0 +1,82 @@
+package network
+
+import (
+	"elevator/types"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"reflect"
+	"strings"
+)
+
+/*
+ * Network-go/bcast panics on a message longer than its buffer,
+ * once the message is encoded as JSON and tagged with its type
+ */
+const MAX_MSG_SIZE = 1024 // bytes
+
+/*
+ * Chunks of the order registry are filled to at most this size,
+ * which leaves room for the orders to grow on the way around the ring
+ */
+const CHUNK_SIZE = 768 // bytes
+
+func encodedSize(value any) int {
+	content, err := json.Marshal(value)
+
+	if err != nil {
+		return math.MaxInt
+	}
+
+	tagged, _ := json.Marshal(struct {
+		TypeId string
+		JSON   []byte
+	}{
+		TypeId: reflect.TypeOf(value).String(),
+		JSON:   content,
+	})
+
+	return len(tagged)
+}
+
+/*
+ * Size of a message once the header is stamped by the last hop
+ */
+func msgSize[T types.Content](msg types.Msg[T]) int {
+	msg.Header.Recipient = -1
+	msg.Header.LoopCounter = 10
+	msg.Header.SenderID = -1
+	msg.Header.SpanID = strings.Repeat("0", 16)
+	msg.Header.SentAt = math.MaxInt64
+
+	return encodedSize(msg)
+}
+
+func Fits[T types.Content](msg types.Msg[T]) bool {
+	return msgSize(msg) <= MAX_MSG_SIZE
+}
+
+/*
+ * Passes on the values which fit in a broadcast and drops the others
+ */
+func Guard[T any](in <-chan T) <-chan T {
+	out := make(chan T)
+
+	go func() {
+		for value := range in {
+			size := encodedSize(value)
+
+			if size > MAX_MSG_SIZE {
+				slog.Error("Dropped message too long to broadcast",
+					"type", reflect.TypeOf(value).String(),
+					"size", size,
+				)
+				continue
+			}
+
+			out <- value
+		}
+	}()
+
+	return out
+}
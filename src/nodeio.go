@@ -0,0 +1,210 @@
+package main
+
+import (
+	"Driver-go/elevio"
+	"Network-go/bcast"
+	"Network-go/peers"
+	"elevator/api"
+	"elevator/elev"
+	"elevator/events"
+	"elevator/journal"
+	"elevator/metrics"
+	"elevator/network"
+	"elevator/timer"
+	"elevator/types"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+/*
+ * Channels between the main loop and the secure transmitter of one message type
+ */
+type ringIO[T types.Content] struct {
+	tx            chan types.Msg[T]
+	txSecure      chan types.Msg[T]
+	rx            chan types.Msg[T]
+	setRecipient  chan int
+	replyReceived chan string
+}
+
+func newRingIO[T types.Content]() ringIO[T] {
+	return ringIO[T]{
+		tx:            make(chan types.Msg[T]),
+		txSecure:      make(chan types.Msg[T]),
+		rx:            make(chan types.Msg[T]),
+		setRecipient:  make(chan int),
+		replyReceived: make(chan string),
+	}
+}
+
+func (r ringIO[T]) startSecureTransmitter() {
+	go network.SecureTransmitter[T](
+		r.setRecipient,
+		r.replyReceived,
+		r.tx,
+		r.txSecure,
+	)
+}
+
+/*
+ * Everything the main loop reads from and writes to outside of the node.
+ * A live node is wired to the elevator and the network,
+ * a replay to a journal and a recorder.
+ */
+type nodeIO struct {
+	drvButtons   chan elevio.ButtonEvent
+	drvFloors    chan int
+	drvObstr     chan bool
+	drvStop      chan bool
+	drvDoorClose chan bool
+	drvLoad      chan int
+	peerUpdate   chan peers.PeerUpdate
+	apiRequests  chan api.Request
+	blinkDone    chan bool
+	statusTx     chan types.CarStatus
+	statusRx     chan types.CarStatus
+
+	bid      ringIO[types.Bid]
+	assign   ringIO[types.Assign]
+	served   ringIO[types.Served]
+	sync     ringIO[types.Sync]
+	census   ringIO[types.Census]
+	reassign ringIO[types.Reassign]
+	fire     ringIO[types.Fire]
+	mode     ringIO[types.Mode]
+
+	newTimer        func(name string, duration time.Duration) (chan bool, chan types.TimerActions)
+	blinkButtonLamp func(button elevio.ButtonEvent, done chan<- bool)
+	pollDoorClose   func(active bool)
+	startPeers      func()
+	journal         journal.Journal
+}
+
+func newNodeIO() *nodeIO {
+	return &nodeIO{
+		drvButtons:   make(chan elevio.ButtonEvent),
+		drvFloors:    make(chan int),
+		drvObstr:     make(chan bool),
+		drvStop:      make(chan bool),
+		drvDoorClose: make(chan bool),
+		drvLoad:      make(chan int),
+		peerUpdate:   make(chan peers.PeerUpdate),
+		apiRequests:  make(chan api.Request),
+		blinkDone:    make(chan bool),
+		statusTx:     make(chan types.CarStatus),
+		statusRx:     make(chan types.CarStatus),
+
+		bid:      newRingIO[types.Bid](),
+		assign:   newRingIO[types.Assign](),
+		served:   newRingIO[types.Served](),
+		sync:     newRingIO[types.Sync](),
+		census:   newRingIO[types.Census](),
+		reassign: newRingIO[types.Reassign](),
+		fire:     newRingIO[types.Fire](),
+		mode:     newRingIO[types.Mode](),
+	}
+}
+
+func liveIO(
+	flags cmdFlags,
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+) *nodeIO {
+
+	io := newNodeIO()
+
+	io.drvButtons, io.drvFloors, io.drvObstr = elev.InitDriver(elevState, elevConfig, flags.elevServerPort)
+
+	if flags.keySwitch {
+		go elevio.PollStopButton(io.drvStop)
+	}
+
+	if flags.loadSensor {
+		go elev.PollLoad(fmt.Sprintf("localhost:%d", flags.elevServerPort), io.drvLoad)
+	}
+
+	writer, err := journal.NewWriter(flags.journal)
+
+	if err != nil {
+		fmt.Println("Error: Journal:", err)
+		os.Exit(1)
+	}
+
+	io.journal = writer
+
+	if flags.inject {
+		injectRx := make(chan types.InjectedButton)
+		loadRx := make(chan types.InjectedLoad)
+
+		go bcast.Receiver(INJECT_PORT, injectRx, loadRx)
+		go elev.ForwardInjectedButtons(elevConfig, injectRx, io.drvButtons)
+		go elev.ForwardInjectedLoads(elevConfig, loadRx, io.drvLoad)
+	}
+
+	if len(flags.httpAddr) > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		mux.Handle("/events", events.Handler())
+
+		api.Register(mux, flags.apiToken, elevConfig, io.apiRequests, io.drvButtons)
+
+		go serveHttp(flags.httpAddr, mux)
+	}
+
+	io.bid.startSecureTransmitter()
+	io.assign.startSecureTransmitter()
+	io.served.startSecureTransmitter()
+	io.sync.startSecureTransmitter()
+	io.census.startSecureTransmitter()
+	io.reassign.startSecureTransmitter()
+	io.fire.startSecureTransmitter()
+	io.mode.startSecureTransmitter()
+
+	go bcast.Transmitter(
+		BCAST_PORT,
+		network.Guard(io.bid.tx),
+		network.Guard(io.assign.tx),
+		network.Guard(io.served.tx),
+		network.Guard(io.sync.tx),
+		network.Guard(io.census.tx),
+		network.Guard(io.reassign.tx),
+		network.Guard(io.fire.tx),
+		network.Guard(io.mode.tx),
+	)
+	go bcast.Receiver(BCAST_PORT, io.bid.rx, io.assign.rx, io.served.rx, io.sync.rx, io.census.rx, io.reassign.rx, io.fire.rx, io.mode.rx)
+
+	go bcast.Transmitter(STATUS_PORT, network.Guard(io.statusTx))
+	go bcast.Receiver(STATUS_PORT, io.statusRx)
+
+	io.newTimer = func(name string, duration time.Duration) (chan bool, chan types.TimerActions) {
+		return timer.New(duration)
+	}
+
+	io.blinkButtonLamp = func(button elevio.ButtonEvent, done chan<- bool) {
+		go elev.BlinkButtonLamp(button, done)
+	}
+
+	var stopDoorClose chan bool
+
+	io.pollDoorClose = func(active bool) {
+		polling := stopDoorClose != nil
+
+		if active && !polling {
+			stopDoorClose = make(chan bool)
+			go elev.PollDoorClose(io.drvDoorClose, elevConfig.NumFloors, stopDoorClose)
+		} else if !active && polling {
+			close(stopDoorClose)
+			stopDoorClose = nil
+		}
+	}
+
+	io.startPeers = func() {
+		go peers.Transmitter(PEER_PORT, strconv.Itoa(elevConfig.NodeID), nil)
+		go peers.Receiver(PEER_PORT, io.peerUpdate)
+	}
+
+	return io
+}
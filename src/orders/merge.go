@@ -0,0 +1,182 @@
+package orders
+
+import (
+	"Driver-go/elevio"
+	"elevator/types"
+)
+
+/*
+ * Merges an incoming registry into the local one.
+ * Served orders are never resurrected, otherwise the copy with
+ * the highest version wins, see isNewer. Orders only known on one side are kept.
+ */
+func Merge(registry types.OrderRegistry, incoming types.OrderRegistry) {
+	for id, newOrder := range incoming {
+		current, exists := registry[id]
+
+		if !exists {
+			if !IsDone(newOrder) {
+				registry[id] = newOrder
+			}
+			continue
+		}
+
+		if IsDone(current) {
+			continue
+		}
+
+		if IsDone(newOrder) || isNewer(newOrder, current) {
+			registry[id] = newOrder
+		}
+	}
+
+	cancelDuplicates(registry)
+}
+
+/*
+ * Two nodes can change the same version of an order at once,
+ * e.g. one acknowledges it while another reassigns it.
+ * Copies with equal versions are ordered by state, then assignee,
+ * then acknowledgement, so every node keeps the same copy.
+ */
+func isNewer(order types.Order, current types.Order) bool {
+	if order.Version != current.Version {
+		return order.Version > current.Version
+	}
+
+	if order.State != current.State {
+		return order.State > current.State
+	}
+
+	if order.Assignee != current.Assignee {
+		return order.Assignee > current.Assignee
+	}
+
+	return order.Acknowledged && !current.Acknowledged
+}
+
+/*
+ * Closes the orders served or cancelled elsewhere, given as tombstones,
+ * and records which nodes hold them. An order not known here is kept
+ * in its final state, so a node which missed the tombstone
+ * cannot bring it back.
+ */
+func MergeTombstones(registry types.OrderRegistry, tombstones map[string]types.Tombstone) {
+	for id, tombstone := range tombstones {
+		current, exists := registry[id]
+
+		if !exists {
+			current = types.Order{
+				ID:       id,
+				Assignee: int(types.UNASSIGNED),
+			}
+		}
+
+		if !IsDone(current) {
+			current.State = tombstone.State
+			current.Version = max(current.Version, tombstone.Version)
+
+			if tombstone.State == types.OS_Served {
+				current.ServedAt = tombstone.ClosedAt
+			} else {
+				current.CancelledAt = tombstone.ClosedAt
+			}
+		}
+
+		current.HeldBy |= tombstone.HeldBy
+
+		registry[id] = current
+	}
+}
+
+/*
+ * The part of the registry sent in one chunk of a sync by nodeID:
+ * the unserved orders and the tombstones with an ID in [from, to)
+ */
+func Chunk(
+	registry types.OrderRegistry,
+	from string,
+	to string,
+	nodeID int,
+) (types.OrderRegistry, map[string]types.Tombstone) {
+
+	unserved := make(types.OrderRegistry)
+	tombstones := make(map[string]types.Tombstone)
+
+	for id, order := range registry {
+		if id < from || (to != "" && id >= to) {
+			continue
+		}
+
+		if IsDone(order) {
+			tombstones[id] = types.Tombstone{
+				State:    order.State,
+				Version:  order.Version,
+				ClosedAt: max(order.ServedAt, order.CancelledAt),
+				HeldBy:   order.HeldBy | 1<<nodeID,
+			}
+		} else {
+			unserved[id] = order
+		}
+	}
+
+	return unserved, tombstones
+}
+
+/*
+ * A hall call accepted on both sides of a partition ends up as two orders.
+ * The oldest order is kept and the others are cancelled. Every node
+ * picks the same order, so the registries still converge.
+ */
+func cancelDuplicates(registry types.OrderRegistry) {
+	oldest := make(map[elevio.ButtonEvent]types.Order)
+
+	for _, order := range registry {
+		if !IsActive(order) || order.Button == elevio.BT_Cab {
+			continue
+		}
+
+		kept, exists := oldest[order.ButtonEvent]
+
+		if !exists || isOlder(order, kept) {
+			oldest[order.ButtonEvent] = order
+		}
+	}
+
+	for _, order := range registry {
+		if !IsActive(order) || order.Button == elevio.BT_Cab {
+			continue
+		}
+
+		if oldest[order.ButtonEvent].ID != order.ID {
+			Cancel(registry, order)
+		}
+	}
+}
+
+/*
+ * Returns true if both registries hold the same unserved orders
+ */
+func Equal(registry types.OrderRegistry, other types.OrderRegistry) bool {
+	return containsUnserved(registry, other) && containsUnserved(other, registry)
+}
+
+func containsUnserved(registry types.OrderRegistry, other types.OrderRegistry) bool {
+	for id, order := range other {
+		if IsDone(order) {
+			continue
+		}
+
+		current, exists := registry[id]
+
+		if !exists ||
+			current.Version != order.Version ||
+			current.State != order.State ||
+			current.Assignee != order.Assignee ||
+			current.Acknowledged != order.Acknowledged {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,241 @@
+package orders
+
+import (
+	"Driver-go/elevio"
+	"elevator/clock"
+	"elevator/types"
+	"testing"
+	"time"
+)
+
+func testOrder(id string, floor int, button elevio.ButtonType, state types.OrderState, version int) types.Order {
+	return types.Order{
+		ButtonEvent: elevio.ButtonEvent{Floor: floor, Button: button},
+		ID:          id,
+		Assignee:    0,
+		State:       state,
+		Version:     version,
+		CreatedAt:   1000,
+	}
+}
+
+func withAssignee(order types.Order, assignee int) types.Order {
+	order.Assignee = assignee
+	return order
+}
+
+func TestMerge(t *testing.T) {
+	clock.Set(time.UnixMilli(100000))
+
+	tests := []struct {
+		name     string
+		current  []types.Order
+		incoming []types.Order
+		want     map[string]types.OrderState
+		assignee map[string]int
+	}{
+		{
+			name:     "unknown order is added",
+			incoming: []types.Order{testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Assigned, 1)},
+			want:     map[string]types.OrderState{"1-a": types.OS_Assigned},
+		},
+		{
+			name:     "unknown served order is not added",
+			incoming: []types.Order{testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Served, 3)},
+			want:     map[string]types.OrderState{},
+		},
+		{
+			name:     "higher version wins",
+			current:  []types.Order{testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Assigned, 1)},
+			incoming: []types.Order{testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Serving, 2)},
+			want:     map[string]types.OrderState{"1-a": types.OS_Serving},
+		},
+		{
+			name:     "lower version loses",
+			current:  []types.Order{testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Serving, 2)},
+			incoming: []types.Order{testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Assigned, 1)},
+			want:     map[string]types.OrderState{"1-a": types.OS_Serving},
+		},
+		{
+			name:     "equal version, higher assignee wins",
+			current:  []types.Order{withAssignee(testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Assigned, 2), 1)},
+			incoming: []types.Order{withAssignee(testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Assigned, 2), 2)},
+			want:     map[string]types.OrderState{"1-a": types.OS_Assigned},
+			assignee: map[string]int{"1-a": 2},
+		},
+		{
+			name:     "equal version, lower assignee loses",
+			current:  []types.Order{withAssignee(testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Assigned, 2), 2)},
+			incoming: []types.Order{withAssignee(testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Assigned, 2), 1)},
+			want:     map[string]types.OrderState{"1-a": types.OS_Assigned},
+			assignee: map[string]int{"1-a": 2},
+		},
+		{
+			name:     "served order is not resurrected",
+			current:  []types.Order{testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Served, 3)},
+			incoming: []types.Order{testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Assigned, 7)},
+			want:     map[string]types.OrderState{"1-a": types.OS_Served},
+		},
+		{
+			name:     "served copy closes the order",
+			current:  []types.Order{testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Assigned, 5)},
+			incoming: []types.Order{testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Served, 3)},
+			want:     map[string]types.OrderState{"1-a": types.OS_Served},
+		},
+		{
+			name: "oldest duplicate hall call is kept",
+			current: []types.Order{
+				testOrder("1-b", 2, elevio.BT_HallUp, types.OS_Assigned, 1),
+			},
+			incoming: []types.Order{
+				testOrder("1-a", 2, elevio.BT_HallUp, types.OS_Assigned, 1),
+			},
+			want: map[string]types.OrderState{
+				"1-a": types.OS_Assigned,
+				"1-b": types.OS_Cancelled,
+			},
+		},
+		{
+			name: "cab calls are not duplicates",
+			current: []types.Order{
+				testOrder("1-b", 2, elevio.BT_Cab, types.OS_Assigned, 1),
+			},
+			incoming: []types.Order{
+				testOrder("2-a", 2, elevio.BT_Cab, types.OS_Assigned, 1),
+			},
+			want: map[string]types.OrderState{
+				"1-b": types.OS_Assigned,
+				"2-a": types.OS_Assigned,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := make(types.OrderRegistry)
+			incoming := make(types.OrderRegistry)
+
+			for _, order := range test.current {
+				registry[order.ID] = order
+			}
+
+			for _, order := range test.incoming {
+				incoming[order.ID] = order
+			}
+
+			Merge(registry, incoming)
+
+			if len(registry) != len(test.want) {
+				t.Fatalf("got %d orders, want %d", len(registry), len(test.want))
+			}
+
+			for id, state := range test.want {
+				if registry[id].State != state {
+					t.Errorf("order %s: got state %d, want %d", id, registry[id].State, state)
+				}
+			}
+
+			for id, assignee := range test.assignee {
+				if registry[id].Assignee != assignee {
+					t.Errorf("order %s: got assignee %d, want %d", id, registry[id].Assignee, assignee)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeTombstones(t *testing.T) {
+	clock.Set(time.UnixMilli(100000))
+
+	registry := types.OrderRegistry{
+		"1-a": testOrder("1-a", 1, elevio.BT_HallUp, types.OS_Assigned, 2),
+		"1-b": testOrder("1-b", 2, elevio.BT_HallUp, types.OS_Served, 3),
+	}
+
+	MergeTombstones(registry, map[string]types.Tombstone{
+		"1-a": {State: types.OS_Served, Version: 4, ClosedAt: 90000, HeldBy: 0b010},
+		"1-b": {State: types.OS_Cancelled, Version: 3, ClosedAt: 95000, HeldBy: 0b100},
+		"1-c": {State: types.OS_Cancelled, Version: 2, ClosedAt: 80000, HeldBy: 0b110},
+	})
+
+	if registry["1-a"].State != types.OS_Served || registry["1-a"].Version != 4 || registry["1-a"].ServedAt != 90000 {
+		t.Errorf("active order not served by tombstone: %+v", registry["1-a"])
+	}
+
+	if registry["1-b"].State != types.OS_Served || registry["1-b"].HeldBy != 0b100 {
+		t.Errorf("served order changed by tombstone: %+v", registry["1-b"])
+	}
+
+	if registry["1-c"].State != types.OS_Cancelled || registry["1-c"].CancelledAt != 80000 || registry["1-c"].HeldBy != 0b110 {
+		t.Errorf("unknown tombstone not kept: %+v", registry["1-c"])
+	}
+
+	/*
+	 * A node which missed the tombstone syncs its stale copy
+	 */
+	Merge(registry, types.OrderRegistry{
+		"1-c": testOrder("1-c", 3, elevio.BT_HallDown, types.OS_Assigned, 5),
+	})
+
+	if registry["1-c"].State != types.OS_Cancelled {
+		t.Errorf("order resurrected after tombstone: %+v", registry["1-c"])
+	}
+}
+
+func TestChunk(t *testing.T) {
+	registry := types.OrderRegistry{
+		"1-a": testOrder("1-a", 0, elevio.BT_Cab, types.OS_Assigned, 1),
+		"1-b": {ID: "1-b", State: types.OS_Served, Version: 2, ServedAt: 90000, HeldBy: 0b001},
+		"1-c": testOrder("1-c", 2, elevio.BT_Cab, types.OS_Assigned, 1),
+		"1-d": testOrder("1-d", 3, elevio.BT_Cab, types.OS_Assigned, 1),
+	}
+
+	unserved, tombstones := Chunk(registry, "1-b", "1-d", 2)
+
+	if len(unserved) != 1 || unserved["1-c"].ID != "1-c" {
+		t.Errorf("got unserved %v, want only 1-c", unserved)
+	}
+
+	want := types.Tombstone{State: types.OS_Served, Version: 2, ClosedAt: 90000, HeldBy: 0b101}
+
+	if len(tombstones) != 1 || tombstones["1-b"] != want {
+		t.Errorf("got tombstones %v, want 1-b: %+v", tombstones, want)
+	}
+
+	unserved, _ = Chunk(registry, "1-c", "", 2)
+
+	if len(unserved) != 2 {
+		t.Errorf("got %d unserved orders from an open chunk, want 2", len(unserved))
+	}
+}
+
+func TestEqual(t *testing.T) {
+	registry := types.OrderRegistry{
+		"1-a": testOrder("1-a", 0, elevio.BT_Cab, types.OS_Assigned, 1),
+		"1-b": testOrder("1-b", 1, elevio.BT_Cab, types.OS_Served, 2),
+	}
+
+	same := types.OrderRegistry{
+		"1-a": testOrder("1-a", 0, elevio.BT_Cab, types.OS_Assigned, 1),
+	}
+
+	newer := types.OrderRegistry{
+		"1-a": testOrder("1-a", 0, elevio.BT_Cab, types.OS_Serving, 2),
+	}
+
+	if !Equal(registry, same) {
+		t.Error("registries with the same unserved orders are not equal")
+	}
+
+	if Equal(registry, newer) {
+		t.Error("registries with different versions are equal")
+	}
+
+	if Equal(registry, types.OrderRegistry{"1-a": withAssignee(registry["1-a"], 1)}) {
+		t.Error("registries with different assignees are equal")
+	}
+
+	if Equal(registry, types.OrderRegistry{}) {
+		t.Error("registry is equal to an empty registry")
+	}
+}
@@ -5,33 +5,34 @@ import (
 	"elevator/types"
 )
 
-func ordersAbove(elevState *types.ElevState, elevConfig *types.ElevConfig) bool {
-	for floor := elevState.Floor + 1; floor < elevConfig.NumFloors; floor++ {
-		for btn := 0; btn < elevConfig.NumButtons; btn++ {
-			if elevState.Orders[elevConfig.NodeID][floor][btn] {
-				return true
-			}
+/*
+ * Collects the active orders of a node into a compact order set
+ */
+func CarOrdersOf(registry types.OrderRegistry, nodeID int, numFloors int) types.CarOrders {
+	carOrders := make(types.CarOrders, numFloors)
+
+	for _, order := range registry {
+		if IsActive(order) && order.Assignee == nodeID && order.Floor < numFloors {
+			carOrders.Set(order.Floor, order.Button)
 		}
 	}
 
-	return false
+	return carOrders
 }
 
-func ordersBelow(elevState *types.ElevState, elevConfig *types.ElevConfig) bool {
-	for floor := 0; floor < elevState.Floor; floor++ {
-		for btn := 0; btn < elevConfig.NumButtons; btn++ {
-			if elevState.Orders[elevConfig.NodeID][floor][btn] {
-				return true
-			}
+func ordersAbove(carOrders types.CarOrders, floor int) bool {
+	for above := floor + 1; above < len(carOrders); above++ {
+		if carOrders[above] != 0 {
+			return true
 		}
 	}
 
 	return false
 }
 
-func ordersHere(elevState *types.ElevState, elevConfig *types.ElevConfig) bool {
-	for btn := 0; btn < elevConfig.NumButtons; btn++ {
-		if elevState.Orders[elevConfig.NodeID][elevState.Floor][btn] {
+func ordersBelow(carOrders types.CarOrders, floor int) bool {
+	for below := 0; below < floor && below < len(carOrders); below++ {
+		if carOrders[below] != 0 {
 			return true
 		}
 	}
@@ -39,36 +40,45 @@ func ordersHere(elevState *types.ElevState, elevConfig *types.ElevConfig) bool {
 	return false
 }
 
-func ChooseDirection(elevState *types.ElevState, elevConfig *types.ElevConfig) types.DirnBehaviourPair {
-	switch elevState.Dirn {
+func ordersHere(carOrders types.CarOrders, floor int) bool {
+	return 0 <= floor && floor < len(carOrders) && carOrders[floor] != 0
+}
+
+func ChooseCarDirection(
+	carOrders types.CarOrders,
+	floor int,
+	dirn elevio.MotorDirection,
+) types.DirnBehaviourPair {
+
+	switch dirn {
 	case elevio.MD_Up:
-		if ordersAbove(elevState, elevConfig) {
+		if ordersAbove(carOrders, floor) {
 			return types.DirnBehaviourPair{Dirn: elevio.MD_Up, Behaviour: types.EB_Moving}
-		} else if ordersHere(elevState, elevConfig) {
+		} else if ordersHere(carOrders, floor) {
 			return types.DirnBehaviourPair{Dirn: elevio.MD_Down, Behaviour: types.EB_DoorOpen}
-		} else if ordersBelow(elevState, elevConfig) {
+		} else if ordersBelow(carOrders, floor) {
 			return types.DirnBehaviourPair{Dirn: elevio.MD_Down, Behaviour: types.EB_Moving}
 		} else {
 			return types.DirnBehaviourPair{Dirn: elevio.MD_Stop, Behaviour: types.EB_Idle}
 		}
 
 	case elevio.MD_Down:
-		if ordersBelow(elevState, elevConfig) {
+		if ordersBelow(carOrders, floor) {
 			return types.DirnBehaviourPair{Dirn: elevio.MD_Down, Behaviour: types.EB_Moving}
-		} else if ordersHere(elevState, elevConfig) {
+		} else if ordersHere(carOrders, floor) {
 			return types.DirnBehaviourPair{Dirn: elevio.MD_Up, Behaviour: types.EB_DoorOpen}
-		} else if ordersAbove(elevState, elevConfig) {
+		} else if ordersAbove(carOrders, floor) {
 			return types.DirnBehaviourPair{Dirn: elevio.MD_Up, Behaviour: types.EB_Moving}
 		} else {
 			return types.DirnBehaviourPair{Dirn: elevio.MD_Stop, Behaviour: types.EB_Idle}
 		}
 
 	case elevio.MD_Stop:
-		if ordersHere(elevState, elevConfig) {
+		if ordersHere(carOrders, floor) {
 			return types.DirnBehaviourPair{Dirn: elevio.MD_Stop, Behaviour: types.EB_DoorOpen}
-		} else if ordersAbove(elevState, elevConfig) {
+		} else if ordersAbove(carOrders, floor) {
 			return types.DirnBehaviourPair{Dirn: elevio.MD_Up, Behaviour: types.EB_Moving}
-		} else if ordersBelow(elevState, elevConfig) {
+		} else if ordersBelow(carOrders, floor) {
 			return types.DirnBehaviourPair{Dirn: elevio.MD_Down, Behaviour: types.EB_Moving}
 		} else {
 			return types.DirnBehaviourPair{Dirn: elevio.MD_Stop, Behaviour: types.EB_Idle}
@@ -79,17 +89,59 @@ func ChooseDirection(elevState *types.ElevState, elevConfig *types.ElevConfig) t
 	}
 }
 
-func ShouldStop(elevState *types.ElevState, elevConfig *types.ElevConfig) bool {
-	switch elevState.Dirn {
+/*
+ * Direction to the parking floor, idle once there
+ */
+func ParkingDirection(floor int, parkingFloor int) types.DirnBehaviourPair {
+	switch {
+	case floor < parkingFloor:
+		return types.DirnBehaviourPair{Dirn: elevio.MD_Up, Behaviour: types.EB_Moving}
+	case floor > parkingFloor:
+		return types.DirnBehaviourPair{Dirn: elevio.MD_Down, Behaviour: types.EB_Moving}
+	default:
+		return types.DirnBehaviourPair{Dirn: elevio.MD_Stop, Behaviour: types.EB_Idle}
+	}
+}
+
+/*
+ * A car without served floors serves every floor,
+ * otherwise it serves none above the last floor in the list
+ */
+func Serves(servedFloors []bool, floor int) bool {
+	return servedFloors == nil || 0 > floor || (floor < len(servedFloors) && servedFloors[floor])
+}
+
+/*
+ * Served floor closest to the given floor, below before above
+ */
+func NearestServedFloor(servedFloors []bool, floor int) int {
+	for distance := 0; distance < len(servedFloors); distance++ {
+		for _, candidate := range []int{floor - distance, floor + distance} {
+			if 0 <= candidate && candidate < len(servedFloors) && servedFloors[candidate] {
+				return candidate
+			}
+		}
+	}
+
+	return floor
+}
+
+func CarShouldStop(
+	carOrders types.CarOrders,
+	floor int,
+	dirn elevio.MotorDirection,
+) bool {
+
+	switch dirn {
 	case elevio.MD_Down:
-		return (elevState.Orders[elevConfig.NodeID][elevState.Floor][elevio.BT_HallDown] ||
-			elevState.Orders[elevConfig.NodeID][elevState.Floor][elevio.BT_Cab] ||
-			!ordersBelow(elevState, elevConfig))
+		return (carOrders.Has(floor, elevio.BT_HallDown) ||
+			carOrders.Has(floor, elevio.BT_Cab) ||
+			!ordersBelow(carOrders, floor))
 
 	case elevio.MD_Up:
-		return (elevState.Orders[elevConfig.NodeID][elevState.Floor][elevio.BT_HallUp] ||
-			elevState.Orders[elevConfig.NodeID][elevState.Floor][elevio.BT_Cab] ||
-			!ordersAbove(elevState, elevConfig))
+		return (carOrders.Has(floor, elevio.BT_HallUp) ||
+			carOrders.Has(floor, elevio.BT_Cab) ||
+			!ordersAbove(carOrders, floor))
 
 	default:
 		return true
@@ -103,28 +155,27 @@ func ShouldClearImmediately(elevState *types.ElevState, order types.Order) bool
 		order.Button == elevio.BT_Cab)
 }
 
-func ClearAtCurrentFloor(
-	elevState *types.ElevState,
-	elevConfig *types.ElevConfig,
+func CarClearAtFloor(
+	carOrders types.CarOrders,
+	floor int,
+	dirn elevio.MotorDirection,
 ) [3]bool {
 
 	var clearOrders [3]bool
-	floor := elevState.Floor
-	id := elevConfig.NodeID
 
 	clearOrders[elevio.BT_Cab] = true
 
-	switch elevState.Dirn {
+	switch dirn {
 	case elevio.MD_Up:
-		if !ordersAbove(elevState, elevConfig) &&
-			!elevState.Orders[id][floor][elevio.BT_HallUp] {
+		if !ordersAbove(carOrders, floor) &&
+			!carOrders.Has(floor, elevio.BT_HallUp) {
 			clearOrders[elevio.BT_HallDown] = true
 		}
 		clearOrders[elevio.BT_HallUp] = true
 
 	case elevio.MD_Down:
-		if !ordersBelow(elevState, elevConfig) &&
-			!elevState.Orders[id][floor][elevio.BT_HallDown] {
+		if !ordersBelow(carOrders, floor) &&
+			!carOrders.Has(floor, elevio.BT_HallDown) {
 			clearOrders[elevio.BT_HallUp] = true
 		}
 		clearOrders[elevio.BT_HallDown] = true
@@ -0,0 +1,300 @@
+package orders
+
+import (
+	"Driver-go/elevio"
+	"elevator/clock"
+	"elevator/types"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+/*
+ * Served orders are kept for a while after they are served,
+ * and until every node holds them as served or cancelled.
+ * This stops a node that missed the served message from
+ * resurrecting the order when order lists are merged.
+ */
+const SERVED_RETENTION = 60000 // ms
+
+func New(button elevio.ButtonEvent, origin int) types.Order {
+	now := clock.Now()
+
+	return types.Order{
+		ButtonEvent: button,
+		ID:          fmt.Sprintf("%d-%s", origin, strconv.FormatInt(now.UnixNano(), 36)),
+		Origin:      origin,
+		Assignee:    int(types.UNASSIGNED),
+		State:       types.OS_Unconfirmed,
+		CreatedAt:   now.UnixMilli(),
+	}
+}
+
+func IsActive(order types.Order) bool {
+	return order.State == types.OS_Assigned || order.State == types.OS_Serving
+}
+
+func IsDone(order types.Order) bool {
+	return order.State == types.OS_Served || order.State == types.OS_Cancelled
+}
+
+/*
+ * Adds an order to the registry unless it is already known
+ */
+func Add(registry types.OrderRegistry, order types.Order) {
+	if _, exists := registry[order.ID]; exists {
+		return
+	}
+
+	registry[order.ID] = order
+}
+
+func Assign(registry types.OrderRegistry, order types.Order, assignee int) {
+	Add(registry, order)
+
+	current := registry[order.ID]
+
+	if IsDone(current) {
+		return
+	}
+
+	if current.Assignee == assignee && current.State != types.OS_Unconfirmed {
+		return
+	}
+
+	if current.Assignee != int(types.UNASSIGNED) && current.Assignee != assignee {
+		current.Reassignments++
+	}
+
+	current.Assignee = assignee
+	current.State = types.OS_Assigned
+	current.Version++
+
+	if current.AssignedAt == 0 {
+		current.AssignedAt = clock.Now().UnixMilli()
+	}
+
+	registry[order.ID] = current
+}
+
+func Acknowledge(registry types.OrderRegistry, order types.Order) {
+	Add(registry, order)
+
+	current := registry[order.ID]
+
+	if IsDone(current) || current.Acknowledged {
+		return
+	}
+
+	current.Acknowledged = true
+	current.Version++
+
+	registry[order.ID] = current
+}
+
+/*
+ * Moves the orders to their new assignees all at once.
+ * Orders already being served are left with their car.
+ */
+func Reassign(registry types.OrderRegistry, assignments map[string]int) {
+	for id, assignee := range assignments {
+		current, exists := registry[id]
+
+		if !exists || current.State != types.OS_Assigned {
+			continue
+		}
+
+		Assign(registry, current, assignee)
+	}
+}
+
+/*
+ * Returns the assignments which differ from the current assignees
+ */
+func ChangedAssignments(registry types.OrderRegistry, assignments map[string]int) map[string]int {
+	changed := make(map[string]int)
+
+	for id, assignee := range assignments {
+		current, exists := registry[id]
+
+		if exists && current.State == types.OS_Assigned && current.Assignee != assignee {
+			changed[id] = assignee
+		}
+	}
+
+	return changed
+}
+
+/*
+ * Marks an order as being served by its assignee,
+ * while the served message travels around the ring
+ */
+func SetServing(registry types.OrderRegistry, order types.Order) {
+	current, exists := registry[order.ID]
+
+	if !exists || current.State != types.OS_Assigned {
+		return
+	}
+
+	current.State = types.OS_Serving
+	current.Version++
+
+	registry[order.ID] = current
+}
+
+func Serve(registry types.OrderRegistry, order types.Order) {
+	Add(registry, order)
+
+	current := registry[order.ID]
+
+	if IsDone(current) {
+		return
+	}
+
+	current.State = types.OS_Served
+	current.Version++
+	current.ArrivedAt = order.ArrivedAt
+	current.ServedAt = order.ServedAt
+
+	if current.ServedAt == 0 {
+		current.ServedAt = clock.Now().UnixMilli()
+	}
+
+	registry[order.ID] = current
+}
+
+func Cancel(registry types.OrderRegistry, order types.Order) {
+	current, exists := registry[order.ID]
+
+	if !exists || IsDone(current) {
+		return
+	}
+
+	current.State = types.OS_Cancelled
+	current.Version++
+	current.CancelledAt = clock.Now().UnixMilli()
+
+	registry[order.ID] = current
+}
+
+/*
+ * Removes served and cancelled orders older than SERVED_RETENTION
+ * which every node holds. An order still active on some node would
+ * otherwise come back the next time it syncs with the others.
+ */
+func Prune(registry types.OrderRegistry, numNodes int, nodeID int) {
+	now := clock.Now().UnixMilli()
+
+	for id, order := range registry {
+		closedAt := max(order.ServedAt, order.CancelledAt)
+
+		if IsDone(order) && heldByAll(order, numNodes, nodeID) && now-closedAt > SERVED_RETENTION {
+			delete(registry, id)
+		}
+	}
+}
+
+/*
+ * Returns true if some served or cancelled order
+ * is not yet known to be held by every node
+ */
+func HasUnheld(registry types.OrderRegistry, numNodes int, nodeID int) bool {
+	for _, order := range registry {
+		if IsDone(order) && !heldByAll(order, numNodes, nodeID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func heldByAll(order types.Order, numNodes int, nodeID int) bool {
+	all := uint32(1)<<numNodes - 1
+
+	return (order.HeldBy|1<<nodeID)&all == all
+}
+
+func isOlder(order types.Order, other types.Order) bool {
+	if order.CreatedAt != other.CreatedAt {
+		return order.CreatedAt < other.CreatedAt
+	}
+	return order.ID < other.ID
+}
+
+/*
+ * Returns true if an order for the same call is not yet served.
+ * Cab calls are only duplicates if made in the same car.
+ */
+func HasPending(registry types.OrderRegistry, button elevio.ButtonEvent, origin int) bool {
+	for _, order := range registry {
+		if IsDone(order) || order.ButtonEvent != button {
+			continue
+		}
+
+		if button.Button != elevio.BT_Cab || order.Origin == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+func Has(registry types.OrderRegistry, nodeID int, floor int, btn elevio.ButtonType) bool {
+	for _, order := range registry {
+		if IsActive(order) && order.Assignee == nodeID && order.Floor == floor && order.Button == btn {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+ * Returns the active orders of a node, oldest first
+ */
+func AssignedTo(registry types.OrderRegistry, nodeID int) []types.Order {
+	var assigned []types.Order
+
+	for _, order := range registry {
+		if IsActive(order) && order.Assignee == nodeID {
+			assigned = append(assigned, order)
+		}
+	}
+
+	SortOldestFirst(assigned)
+
+	return assigned
+}
+
+func SortOldestFirst(orderList []types.Order) {
+	slices.SortFunc(orderList, func(a, b types.Order) int {
+		if isOlder(a, b) {
+			return -1
+		} else if isOlder(b, a) {
+			return 1
+		}
+		return 0
+	})
+}
+
+/*
+ * Returns the active orders of a node at a floor
+ * for the buttons that should be cleared
+ */
+func ToClearAtFloor(
+	registry types.OrderRegistry,
+	nodeID int,
+	floor int,
+	clearOrders [3]bool,
+) []types.Order {
+
+	var toClear []types.Order
+
+	for _, order := range AssignedTo(registry, nodeID) {
+		if order.Floor == floor && clearOrders[order.Button] {
+			toClear = append(toClear, order)
+		}
+	}
+
+	return toClear
+}
@@ -0,0 +1,127 @@
+package orders
+
+import (
+	"Driver-go/elevio"
+	"elevator/clock"
+	"elevator/types"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	clock.Set(time.UnixMilli(200000))
+
+	tests := []struct {
+		name     string
+		order    types.Order
+		numNodes int
+		kept     bool
+	}{
+		{
+			name:     "active order is kept",
+			order:    types.Order{ID: "1-a", State: types.OS_Assigned, HeldBy: 0b111},
+			numNodes: 3,
+			kept:     true,
+		},
+		{
+			name:     "recent tombstone is kept",
+			order:    types.Order{ID: "1-a", State: types.OS_Served, ServedAt: 190000, HeldBy: 0b111},
+			numNodes: 3,
+			kept:     true,
+		},
+		{
+			name:     "tombstone not held by every node is kept",
+			order:    types.Order{ID: "1-a", State: types.OS_Served, ServedAt: 1000, HeldBy: 0b011},
+			numNodes: 3,
+			kept:     true,
+		},
+		{
+			name:     "old tombstone held by every node is removed",
+			order:    types.Order{ID: "1-a", State: types.OS_Served, ServedAt: 1000, HeldBy: 0b110},
+			numNodes: 3,
+			kept:     false,
+		},
+		{
+			name:     "old cancelled order on a single node is removed",
+			order:    types.Order{ID: "1-a", State: types.OS_Cancelled, CancelledAt: 1000},
+			numNodes: 1,
+			kept:     false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := types.OrderRegistry{test.order.ID: test.order}
+
+			Prune(registry, test.numNodes, 0)
+
+			_, kept := registry[test.order.ID]
+
+			if kept != test.kept {
+				t.Errorf("got kept %v, want %v", kept, test.kept)
+			}
+		})
+	}
+}
+
+func TestHasUnheld(t *testing.T) {
+	registry := types.OrderRegistry{
+		"1-a": {ID: "1-a", State: types.OS_Assigned},
+		"1-b": {ID: "1-b", State: types.OS_Served, HeldBy: 0b110},
+	}
+
+	if HasUnheld(registry, 3, 0) {
+		t.Error("tombstone held by every node reported as unheld")
+	}
+
+	if !HasUnheld(registry, 4, 0) {
+		t.Error("tombstone missing on node 3 not reported as unheld")
+	}
+}
+
+/*
+ * A tombstone outlives a partition longer than SERVED_RETENTION
+ * and still closes the stale copy on the other side
+ */
+func TestTombstoneOutlivesPartition(t *testing.T) {
+	clock.Set(time.UnixMilli(100000))
+
+	order := New(elevio.ButtonEvent{Floor: 2, Button: elevio.BT_HallDown}, 1)
+
+	connected := make(types.OrderRegistry)
+	partitioned := make(types.OrderRegistry)
+
+	Assign(connected, order, 0)
+	Assign(partitioned, order, 0)
+	Serve(connected, connected[order.ID])
+
+	clock.Set(time.UnixMilli(100000 + 10*SERVED_RETENTION))
+
+	Prune(connected, 2, 0)
+
+	if _, kept := connected[order.ID]; !kept {
+		t.Fatal("tombstone pruned before the partitioned node held it")
+	}
+
+	_, tombstones := Chunk(connected, "", "", 0)
+
+	MergeTombstones(partitioned, tombstones)
+	Merge(connected, partitioned)
+
+	if connected[order.ID].State != types.OS_Served {
+		t.Errorf("order resurrected: %+v", connected[order.ID])
+	}
+
+	if partitioned[order.ID].State != types.OS_Served || partitioned[order.ID].ServedAt != 100000 {
+		t.Errorf("stale copy not closed as served: %+v", partitioned[order.ID])
+	}
+
+	_, tombstones = Chunk(partitioned, "", "", 1)
+
+	MergeTombstones(connected, tombstones)
+	Prune(connected, 2, 0)
+
+	if _, kept := connected[order.ID]; kept {
+		t.Error("tombstone held by every node not pruned")
+	}
+}
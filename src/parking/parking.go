@@ -0,0 +1,194 @@
+package parking
+
+import (
+	"elevator/clock"
+	"elevator/orders"
+	"elevator/schedule"
+	"elevator/types"
+	"slices"
+	"time"
+)
+
+/*
+ * Status broadcasts older than this are from a car which has left
+ */
+const STATUS_TIMEOUT = 2000 // ms
+
+type Strategy int
+
+const (
+	PS_None Strategy = iota
+	PS_Home
+	PS_Zones
+)
+
+/*
+ * Strategy: PS_Home sends every idle car to the home floor,
+ * PS_Zones spreads the idle cars evenly over the floors.
+ * The traffic mode overrides the strategy: in up-peak the idle cars
+ * park at the lobby, in down-peak they spread over the upper half
+ * of the floors, and at night they park at the home floor.
+ *
+ * IdleTime: ms a car waits idle before it goes to park
+ *
+ * Lobby, LobbyFrom, LobbyTo: between these hours of the day,
+ * one idle car always parks at the lobby. Disabled if they are equal.
+ */
+type Config struct {
+	Strategy  Strategy
+	HomeFloor int
+	IdleTime  int
+	Lobby     int
+	LobbyFrom int
+	LobbyTo   int
+}
+
+type seenCar struct {
+	status types.CarStatus
+	seenAt time.Time
+}
+
+/*
+ * Chooses where an idle car parks from the status broadcasts of the
+ * other cars. Two cars never park on the same floor: a floor taken
+ * by a car with a lower node id is left to it.
+ */
+type Planner struct {
+	config    Config
+	cars      map[int]seenCar
+	idleSince time.Time
+}
+
+func New(config Config) *Planner {
+	return &Planner{
+		config: config,
+		cars:   make(map[int]seenCar),
+	}
+}
+
+func (p *Planner) OnStatus(status types.CarStatus) {
+	p.cars[status.NodeID] = seenCar{status: status, seenAt: clock.Now()}
+}
+
+/*
+ * Returns the floor the car parks at, or -1 if it should stay where it is.
+ * Idle is false while the car is busy or can not take orders.
+ */
+func (p *Planner) Choose(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	idle bool,
+) int {
+
+	now := clock.Now()
+	hasOrders := len(orders.AssignedTo(elevState.Orders, elevConfig.NodeID)) > 0
+
+	parks := p.config.Strategy != PS_None || elevState.TrafficMode != types.TM_Normal
+
+	if !parks || !idle || hasOrders || elevState.Floor < 0 {
+		p.idleSince = time.Time{}
+		return -1
+	}
+
+	if p.idleSince.IsZero() {
+		p.idleSince = now
+	}
+
+	if now.Sub(p.idleSince) < time.Duration(p.config.IdleTime)*time.Millisecond {
+		return -1
+	}
+
+	idleCars := []int{elevConfig.NodeID}
+	var taken []int
+
+	for nodeID, car := range p.cars {
+		if nodeID == elevConfig.NodeID || now.Sub(car.seenAt) > STATUS_TIMEOUT*time.Millisecond {
+			continue
+		}
+
+		floor, parked := parkedAt(car.status)
+
+		if !parked {
+			continue
+		}
+
+		idleCars = append(idleCars, nodeID)
+
+		if nodeID < elevConfig.NodeID {
+			taken = append(taken, floor)
+		}
+	}
+
+	slices.Sort(idleCars)
+	rank := slices.Index(idleCars, elevConfig.NodeID)
+
+	preferred := p.config.HomeFloor
+
+	switch {
+	case elevState.TrafficMode == types.TM_UpPeak:
+		preferred = p.config.Lobby
+
+	case elevState.TrafficMode == types.TM_DownPeak:
+		upperFloors := elevConfig.NumFloors - elevConfig.NumFloors/2
+		preferred = elevConfig.NumFloors/2 + zone(rank, len(idleCars), upperFloors)
+
+	case elevState.TrafficMode == types.TM_Night:
+		preferred = p.config.HomeFloor
+
+	case rank == 0 && schedule.InHours(p.config.LobbyFrom, p.config.LobbyTo, now):
+		preferred = p.config.Lobby
+
+	case p.config.Strategy == PS_Zones:
+		preferred = zone(rank, len(idleCars), elevConfig.NumFloors)
+	}
+
+	return nearestFree(preferred, taken, elevConfig)
+}
+
+/*
+ * Floor an idle car is parked at or on its way to
+ */
+func parkedAt(status types.CarStatus) (int, bool) {
+	switch {
+	case status.OutOfService || status.Independent || status.FireRecall || status.Stuck:
+		return -1, false
+
+	case status.ParkingFloor >= 0:
+		return status.ParkingFloor, true
+
+	case status.Behaviour == types.EB_Idle && len(status.Orders) == 0:
+		return status.Floor, status.Floor >= 0
+	}
+
+	return -1, false
+}
+
+/*
+ * Middle floor of the zone of the car with the given rank,
+ * when the floors are split evenly between the cars
+ */
+func zone(rank int, numCars int, numFloors int) int {
+	return (2*rank + 1) * numFloors / (2 * numCars)
+}
+
+/*
+ * The floor served by the car closest to the preferred one
+ * which is not taken, below before above
+ */
+func nearestFree(preferred int, taken []int, elevConfig *types.ElevConfig) int {
+	free := func(floor int) bool {
+		return 0 <= floor && floor < elevConfig.NumFloors &&
+			orders.Serves(elevConfig.ServedFloors, floor) &&
+			!slices.Contains(taken, floor)
+	}
+
+	for distance := 0; distance < elevConfig.NumFloors; distance++ {
+		for _, floor := range []int{preferred - distance, preferred + distance} {
+			if free(floor) {
+				return floor
+			}
+		}
+	}
+
+	return orders.NearestServedFloor(elevConfig.ServedFloors, preferred)
+}
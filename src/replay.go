@@ -0,0 +1,484 @@
+package main
+
+import (
+	"Driver-go/elevio"
+	"Network-go/peers"
+	"elevator/api"
+	"elevator/clock"
+	"elevator/dispatch"
+	"elevator/elev"
+	"elevator/journal"
+	"elevator/logging"
+	"elevator/parking"
+	"elevator/schedule"
+	"elevator/types"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+var MOTOR_NAMES = map[elevio.MotorDirection]string{
+	elevio.MD_Up:   "up",
+	elevio.MD_Down: "down",
+	elevio.MD_Stop: "stop",
+}
+
+var BUTTON_NAMES = map[elevio.ButtonType]string{
+	elevio.BT_HallUp:   "hall_up",
+	elevio.BT_HallDown: "hall_down",
+	elevio.BT_Cab:      "cab",
+}
+
+var TIMER_ACTION_NAMES = map[types.TimerActions]string{
+	types.START: "started",
+	types.STOP:  "stopped",
+}
+
+/*
+ * A channel the main loop writes to, and how to print what it writes
+ */
+type output struct {
+	ch     reflect.Value
+	format func(value reflect.Value) string
+}
+
+/*
+ * Stands in for the elevator, the network, the timers and the journal writer.
+ * Inputs are given to the main loop one at a time, and every output
+ * is printed in the order the main loop made it.
+ */
+type replayer struct {
+	start      journal.Start
+	entries    []journal.Entry
+	io         *nodeIO
+	elevState  *types.ElevState
+	elevConfig *types.ElevConfig
+	outputs    []output
+	lines      chan string
+	timeouts   map[string]chan bool
+	stepDone   chan bool
+	flush      chan chan bool
+	taken      bool
+}
+
+/*
+ * Runs the node on the inputs of a journal and prints its outputs
+ */
+func runReplay(args []string) {
+	replayFlags := flag.NewFlagSet("replay", flag.ExitOnError)
+	path := replayFlags.String("journal", "", "Journal to replay")
+	logLevel := replayFlags.String("loglevel", "warn", "Log level: debug, info, warn or error")
+	replayFlags.Parse(args)
+
+	if !logging.ValidLevel(*logLevel) {
+		fmt.Println("Invalid log level, use flag -h to see usage")
+		os.Exit(1)
+	}
+
+	entries, err := journal.Read(*path)
+
+	if err != nil {
+		fmt.Println("Error: Journal:", err)
+		os.Exit(1)
+	}
+
+	if len(entries) == 0 || entries[0].Kind != journal.JK_Start {
+		fmt.Println("Error: Journal does not begin with a start entry")
+		os.Exit(1)
+	}
+
+	var start journal.Start
+
+	err = json.Unmarshal(entries[0].Data, &start)
+
+	if err != nil {
+		fmt.Println("Error: Journal:", err)
+		os.Exit(1)
+	}
+
+	dispatcher, valid := dispatch.New(start.Dispatch)
+
+	if !valid {
+		fmt.Println("Error: Journal has unknown dispatch strategy", start.Dispatch)
+		os.Exit(1)
+	}
+
+	if start.NumFloors < 2 {
+		fmt.Println("Error: Journal has no floor count, it was recorded by an older version")
+		os.Exit(1)
+	}
+
+	calendar, err := schedule.Parse(start.Calendar)
+
+	if err != nil {
+		fmt.Println("Error: Journal has invalid calendar:", err)
+		os.Exit(1)
+	}
+
+	logging.Setup(logging.Config{Level: *logLevel}, start.NodeID)
+
+	flags := cmdFlags{
+		nodeID:             start.NodeID,
+		numNodes:           start.NumNodes,
+		numFloors:          start.NumFloors,
+		hallLightGuarantee: start.HallLightGuarantee,
+		offlinePolicy:      types.OfflinePolicy(start.OfflinePolicy),
+		maintenanceFloor:   start.MaintenanceFloor,
+		maintenancePolicy:  types.MaintenancePolicy(start.MaintenancePolicy),
+		maintenance:        start.Maintenance,
+		recallFloor:        start.RecallFloor,
+		servedFloors:       start.ServedFloors,
+		travelTime:         start.TravelTime,
+		doorOpenDuration:   start.DoorOpenDuration,
+		capacity:           start.Capacity,
+		calendarSpec:       start.Calendar,
+		calendar:           calendar,
+		dispatchStrategy:   start.Dispatch,
+		dispatcher:         dispatcher,
+		parking: parking.Config{
+			Strategy:  parking.Strategy(start.ParkStrategy),
+			HomeFloor: start.HomeFloor,
+			IdleTime:  start.ParkAfter,
+			Lobby:     start.Lobby,
+			LobbyFrom: start.LobbyFrom,
+			LobbyTo:   start.LobbyTo,
+		},
+	}
+
+	clock.Set(time.Unix(0, entries[0].Time))
+
+	r := &replayer{
+		start:    start,
+		entries:  entries[1:],
+		lines:    make(chan string),
+		timeouts: make(map[string]chan bool),
+		stepDone: make(chan bool),
+		flush:    make(chan chan bool),
+	}
+
+	runNode(flags, r.setup)
+}
+
+func (r *replayer) setup(
+	flags cmdFlags,
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+) *nodeIO {
+
+	io := newNodeIO()
+
+	elev.SetDriver(r)
+
+	io.journal = r
+	io.newTimer = r.newTimer
+	io.startPeers = func() {}
+	io.pollDoorClose = func(active bool) {}
+
+	io.blinkButtonLamp = func(button elevio.ButtonEvent, done chan<- bool) {
+		r.lines <- fmt.Sprintf("blink %s lamp at floor %d", BUTTON_NAMES[button.Button], button.Floor)
+	}
+
+	r.outputs = append(r.outputs, output{
+		ch: reflect.ValueOf(r.lines),
+		format: func(value reflect.Value) string {
+			return value.String()
+		},
+	})
+
+	r.outputs = append(r.outputs, ringOutputs("bid", io.bid)...)
+	r.outputs = append(r.outputs, ringOutputs("assign", io.assign)...)
+	r.outputs = append(r.outputs, ringOutputs("served", io.served)...)
+	r.outputs = append(r.outputs, ringOutputs("sync", io.sync)...)
+	r.outputs = append(r.outputs, ringOutputs("census", io.census)...)
+	r.outputs = append(r.outputs, ringOutputs("reassign", io.reassign)...)
+	r.outputs = append(r.outputs, ringOutputs("fire", io.fire)...)
+	r.outputs = append(r.outputs, ringOutputs("mode", io.mode)...)
+
+	r.outputs = append(r.outputs, output{
+		ch: reflect.ValueOf(io.statusTx),
+		format: func(value reflect.Value) string {
+			status := value.Interface().(types.CarStatus)
+			return fmt.Sprintf("status broadcast, floor %d, %s", status.Floor, status.Behaviour)
+		},
+	})
+
+	r.io = io
+	r.elevState = elevState
+	r.elevConfig = elevConfig
+
+	return io
+}
+
+func ringOutputs[T types.Content](name string, ring ringIO[T]) []output {
+	content := func(msg types.Msg[T]) string {
+		encoded, _ := json.Marshal(msg.Content)
+		return string(encoded)
+	}
+
+	return []output{
+		{
+			ch: reflect.ValueOf(ring.tx),
+			format: func(value reflect.Value) string {
+				msg := value.Interface().(types.Msg[T])
+				return fmt.Sprintf("%s forwarded to %d: %s", name, msg.Header.Recipient, content(msg))
+			},
+		},
+		{
+			ch: reflect.ValueOf(ring.txSecure),
+			format: func(value reflect.Value) string {
+				return fmt.Sprintf("%s sent: %s", name, content(value.Interface().(types.Msg[T])))
+			},
+		},
+		{
+			ch: reflect.ValueOf(ring.setRecipient),
+			format: func(value reflect.Value) string {
+				return fmt.Sprintf("%s recipient set to %d", name, value.Int())
+			},
+		},
+		{
+			ch: reflect.ValueOf(ring.replyReceived),
+			format: func(value reflect.Value) string {
+				return fmt.Sprintf("%s reply received", name)
+			},
+		},
+	}
+}
+
+func (r *replayer) newTimer(name string, duration time.Duration) (chan bool, chan types.TimerActions) {
+	timeout := make(chan bool)
+	actions := make(chan types.TimerActions)
+
+	r.timeouts[name] = timeout
+
+	r.outputs = append(r.outputs, output{
+		ch: reflect.ValueOf(actions),
+		format: func(value reflect.Value) string {
+			return fmt.Sprintf("%s timer %s", name, TIMER_ACTION_NAMES[value.Interface().(types.TimerActions)])
+		},
+	})
+
+	return timeout, actions
+}
+
+/*
+ * The start entry is recorded once every output has been set up
+ */
+func (r *replayer) Record(kind journal.Kind, data any) {
+	if kind == journal.JK_Start {
+		go r.drain()
+
+		elev.ResetOutputs(r.elevState, r.elevConfig)
+
+		go r.play()
+		return
+	}
+
+	r.taken = true
+}
+
+func (r *replayer) Step() {
+	if r.taken {
+		r.taken = false
+		r.stepDone <- true
+	}
+}
+
+func (r *replayer) play() {
+	for i, entry := range r.entries {
+		clock.Set(time.Unix(0, entry.Time))
+
+		fmt.Printf("\n[%d] %s %s %s\n",
+			i+1,
+			time.Unix(0, entry.Time).Format("15:04:05.000"),
+			entry.Kind,
+			entry.Data,
+		)
+
+		reply, err := r.send(entry)
+
+		if err != nil {
+			fmt.Println("  skipped:", err)
+			continue
+		}
+
+		<-r.stepDone
+
+		flushed := make(chan bool)
+		r.flush <- flushed
+		<-flushed
+
+		if reply != nil {
+			select {
+			case rep := <-reply:
+				if rep.Err != nil {
+					fmt.Println("  reply:", rep.Err)
+				}
+			default:
+			}
+		}
+	}
+
+	fmt.Println("\nEnd of journal")
+	os.Exit(0)
+}
+
+/*
+ * Gives the input of the entry to the main loop,
+ * API requests return the channel the main loop replies on
+ */
+func (r *replayer) send(entry journal.Entry) (chan api.Reply, error) {
+	switch entry.Kind {
+	case journal.JK_Button:
+		return nil, decodeTo(entry.Data, r.io.drvButtons)
+	case journal.JK_Floor:
+		return nil, decodeTo(entry.Data, r.io.drvFloors)
+	case journal.JK_Obstr:
+		return nil, decodeTo(entry.Data, r.io.drvObstr)
+	case journal.JK_KeySwitch:
+		return nil, decodeTo(entry.Data, r.io.drvStop)
+	case journal.JK_DoorClose:
+		return nil, decodeTo(entry.Data, r.io.drvDoorClose)
+	case journal.JK_Load:
+		return nil, decodeTo(entry.Data, r.io.drvLoad)
+	case journal.JK_Peers:
+		return nil, decodeTo[peers.PeerUpdate](entry.Data, r.io.peerUpdate)
+	case journal.JK_Bid:
+		return nil, decodeTo(entry.Data, r.io.bid.rx)
+	case journal.JK_Assign:
+		return nil, decodeTo(entry.Data, r.io.assign.rx)
+	case journal.JK_Served:
+		return nil, decodeTo(entry.Data, r.io.served.rx)
+	case journal.JK_Sync:
+		return nil, decodeTo(entry.Data, r.io.sync.rx)
+	case journal.JK_Census:
+		return nil, decodeTo(entry.Data, r.io.census.rx)
+	case journal.JK_Reassign:
+		return nil, decodeTo(entry.Data, r.io.reassign.rx)
+	case journal.JK_Fire:
+		return nil, decodeTo(entry.Data, r.io.fire.rx)
+	case journal.JK_Mode:
+		return nil, decodeTo(entry.Data, r.io.mode.rx)
+	case journal.JK_Status:
+		return nil, decodeTo(entry.Data, r.io.statusRx)
+
+	case journal.JK_Blink:
+		r.io.blinkDone <- true
+		return nil, nil
+
+	case journal.JK_Timeout:
+		var timeout journal.Timeout
+
+		err := json.Unmarshal(entry.Data, &timeout)
+
+		if err != nil {
+			return nil, err
+		}
+
+		timeoutCh, exists := r.timeouts[timeout.Timer]
+
+		if !exists {
+			return nil, fmt.Errorf("unknown timer %s", timeout.Timer)
+		}
+
+		timeoutCh <- true
+		return nil, nil
+
+	case journal.JK_Api:
+		var request journal.ApiRequest
+
+		err := json.Unmarshal(entry.Data, &request)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reply := make(chan api.Reply, 1)
+
+		r.io.apiRequests <- api.Request{
+			Kind:        api.RequestKind(request.Kind),
+			InService:   request.InService,
+			Independent: request.Independent,
+			Recall:      request.Recall,
+			FireService: request.FireService,
+			Reply:       reply,
+		}
+
+		return reply, nil
+	}
+
+	return nil, errors.New("unknown kind of entry")
+}
+
+func decodeTo[T any](data json.RawMessage, ch chan<- T) error {
+	var value T
+
+	err := json.Unmarshal(data, &value)
+
+	if err != nil {
+		return err
+	}
+
+	ch <- value
+	return nil
+}
+
+/*
+ * Prints the outputs in the order they are made,
+ * a flush is answered once every earlier output is printed
+ */
+func (r *replayer) drain() {
+	cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(r.flush)}}
+
+	for _, out := range r.outputs {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: out.ch})
+	}
+
+	for {
+		chosen, value, _ := reflect.Select(cases)
+
+		if chosen == 0 {
+			value.Interface().(chan bool) <- true
+			continue
+		}
+
+		fmt.Println("  " + r.outputs[chosen-1].format(value))
+	}
+}
+
+/*
+ * The driver records the outputs instead of setting them
+ */
+func (r *replayer) SetMotorDirection(dirn elevio.MotorDirection) {
+	r.lines <- "motor " + MOTOR_NAMES[dirn]
+}
+
+func (r *replayer) SetButtonLamp(button elevio.ButtonType, floor int, value bool) {
+	r.lines <- fmt.Sprintf("%s lamp at floor %d %s", BUTTON_NAMES[button], floor, onOff(value))
+}
+
+func (r *replayer) SetFloorIndicator(floor int) {
+	r.lines <- fmt.Sprintf("floor indicator %d", floor)
+}
+
+func (r *replayer) SetDoorOpenLamp(value bool) {
+	r.lines <- "door lamp " + onOff(value)
+}
+
+func (r *replayer) SetStopLamp(value bool) {
+	r.lines <- "stop lamp " + onOff(value)
+}
+
+func (r *replayer) GetFloor() int {
+	return r.start.InitialFloor
+}
+
+func onOff(value bool) string {
+	if value {
+		return "on"
+	}
+	return "off"
+}
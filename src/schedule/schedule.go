@@ -0,0 +1,176 @@
+package schedule
+
+import (
+	"elevator/types"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var MODES = map[string]types.TrafficMode{
+	"normal":   types.TM_Normal,
+	"uppeak":   types.TM_UpPeak,
+	"downpeak": types.TM_DownPeak,
+	"night":    types.TM_Night,
+}
+
+var DAYS = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+/*
+ * The mode is active from hour From until hour To, on the days
+ * from FirstDay to LastDay. Hours and days may wrap around.
+ */
+type Entry struct {
+	Mode     types.TrafficMode
+	From     int
+	To       int
+	FirstDay time.Weekday
+	LastDay  time.Weekday
+}
+
+/*
+ * The first entry active at a time gives the mode,
+ * the mode is normal when no entry is active
+ */
+type Calendar []Entry
+
+/*
+ * Parses a calendar such as "uppeak 7-10 mon-fri, downpeak 16-19 mon-fri, night 23-6".
+ * The days may be left out for every day, or be a single day.
+ */
+func Parse(calendar string) (Calendar, error) {
+	var result Calendar
+
+	if len(strings.TrimSpace(calendar)) == 0 {
+		return result, nil
+	}
+
+	for _, entryStr := range strings.Split(calendar, ",") {
+		fields := strings.Fields(entryStr)
+
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("invalid calendar entry %q", entryStr)
+		}
+
+		mode, exists := MODES[fields[0]]
+
+		if !exists {
+			return nil, fmt.Errorf("unknown traffic mode %q", fields[0])
+		}
+
+		from, to, valid := ParseHours(fields[1])
+
+		if !valid {
+			return nil, fmt.Errorf("invalid hours %q", fields[1])
+		}
+
+		entry := Entry{Mode: mode, From: from, To: to, FirstDay: time.Sunday, LastDay: time.Saturday}
+
+		if len(fields) == 3 {
+			first, last, _ := strings.Cut(fields[2], "-")
+
+			if len(last) == 0 {
+				last = first
+			}
+
+			firstDay, firstValid := DAYS[first]
+			lastDay, lastValid := DAYS[last]
+
+			if !firstValid || !lastValid {
+				return nil, fmt.Errorf("invalid days %q", fields[2])
+			}
+
+			entry.FirstDay = firstDay
+			entry.LastDay = lastDay
+		}
+
+		result = append(result, entry)
+	}
+
+	return result, nil
+}
+
+func (c Calendar) ModeAt(t time.Time) types.TrafficMode {
+	for _, entry := range c {
+		if entry.activeAt(t) {
+			return entry.Mode
+		}
+	}
+
+	return types.TM_Normal
+}
+
+/*
+ * Hours wrapping past midnight belong to the day they start on,
+ * so after midnight the days are checked against the day before
+ */
+func (e Entry) activeAt(t time.Time) bool {
+	if !InHours(e.From, e.To, t) {
+		return false
+	}
+
+	day := t
+
+	if e.From > e.To && t.Hour() < e.To {
+		day = t.AddDate(0, 0, -1)
+	}
+
+	return inDays(e.FirstDay, e.LastDay, day)
+}
+
+/*
+ * Parses hours of the day such as "7-10", an empty string is no hours
+ */
+func ParseHours(hours string) (int, int, bool) {
+	if len(hours) == 0 {
+		return 0, 0, true
+	}
+
+	from, to, found := strings.Cut(hours, "-")
+
+	if !found {
+		return 0, 0, false
+	}
+
+	fromHour, errFrom := strconv.Atoi(from)
+	toHour, errTo := strconv.Atoi(to)
+
+	if errFrom != nil || errTo != nil || fromHour < 0 || fromHour > 23 || toHour < 0 || toHour > 23 {
+		return 0, 0, false
+	}
+
+	return fromHour, toHour, true
+}
+
+/*
+ * Whether the time is from hour from until hour to,
+ * never if they are equal
+ */
+func InHours(from int, to int, t time.Time) bool {
+	hour := t.Hour()
+
+	if from <= to {
+		return from <= hour && hour < to
+	}
+
+	return from <= hour || hour < to
+}
+
+func inDays(first time.Weekday, last time.Weekday, t time.Time) bool {
+	day := t.Weekday()
+
+	if first <= last {
+		return first <= day && day <= last
+	}
+
+	return first <= day || day <= last
+}
@@ -0,0 +1,80 @@
+package schedule
+
+import (
+	"elevator/types"
+	"testing"
+	"time"
+)
+
+func TestModeAt(t *testing.T) {
+	calendar, err := Parse("uppeak 7-10 mon-fri, night 22-6 mon-fri, downpeak 16-19 sat")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/*
+	 * 2024-01-01 is a Monday
+	 */
+	at := func(day int, hour int) time.Time {
+		return time.Date(2024, time.January, day, hour, 30, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name string
+		time time.Time
+		want types.TrafficMode
+	}{
+		{"monday morning", at(1, 8), types.TM_UpPeak},
+		{"monday noon", at(1, 12), types.TM_Normal},
+		{"monday before midnight", at(1, 23), types.TM_Night},
+		{"tuesday after midnight", at(2, 3), types.TM_Night},
+		{"tuesday when night ends", at(2, 6), types.TM_Normal},
+		{"saturday after friday night", at(6, 2), types.TM_Night},
+		{"saturday before midnight", at(6, 23), types.TM_Normal},
+		{"monday after sunday", at(1, 2), types.TM_Normal},
+		{"saturday afternoon", at(6, 17), types.TM_DownPeak},
+		{"sunday afternoon", at(7, 17), types.TM_Normal},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := calendar.ModeAt(test.time)
+
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	invalid := []string{
+		"uppeak",
+		"rush 7-10",
+		"uppeak 7",
+		"uppeak 7-24",
+		"uppeak 7-10 someday",
+		"uppeak 7-10 mon-fri extra",
+	}
+
+	for _, calendar := range invalid {
+		_, err := Parse(calendar)
+
+		if err == nil {
+			t.Errorf("Parse(%q) accepted an invalid calendar", calendar)
+		}
+	}
+
+	calendar, err := Parse("night 23-6 sun")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Entry{Mode: types.TM_Night, From: 23, To: 6, FirstDay: time.Sunday, LastDay: time.Sunday}
+
+	if len(calendar) != 1 || calendar[0] != want {
+		t.Errorf("got %+v, want %+v", calendar, want)
+	}
+}
@@ -0,0 +1,328 @@
+package trace
+
+import (
+	"crypto/rand"
+	"elevator/types"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * Finished spans are appended to the trace file this often
+ */
+const EXPORT_PERIOD = 5000 // ms
+
+/*
+ * Spans kept while waiting to be exported, the oldest are dropped first
+ */
+const MAX_PENDING = 10000
+
+const (
+	SK_Producer = 4
+	SK_Consumer = 5
+)
+
+/*
+ * A span in the OpenTelemetry (OTLP) JSON encoding
+ */
+type span struct {
+	TraceID      string     `json:"traceId"`
+	SpanID       string     `json:"spanId"`
+	ParentSpanID string     `json:"parentSpanId,omitempty"`
+	Name         string     `json:"name"`
+	Kind         int        `json:"kind"`
+	Start        string     `json:"startTimeUnixNano"`
+	End          string     `json:"endTimeUnixNano"`
+	Attributes   []keyValue `json:"attributes"`
+	Events       []event    `json:"events,omitempty"`
+}
+
+type event struct {
+	Time string `json:"timeUnixNano"`
+	Name string `json:"name"`
+}
+
+type keyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+/*
+ * Message sent by this node which is waiting for its reply
+ */
+type sendSpan struct {
+	span
+	firstSent   time.Time
+	retransmits int
+}
+
+var nodeID = -1
+var enabled = false
+
+var lock sync.Mutex
+var sending = make(map[string]*sendSpan)
+var pending []span
+
+/*
+ * Appends the spans to the file as one OTLP JSON request per line,
+ * nothing is collected if the path is empty
+ */
+func Setup(path string, id int) error {
+	nodeID = id
+
+	if len(path) == 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	enabled = true
+	lock.Unlock()
+
+	go export(file)
+
+	return nil
+}
+
+/*
+ * Starts the span of a message from when it is queued until its reply is received
+ */
+func Queued(msgName string, header types.Header) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if !enabled {
+		return
+	}
+
+	sending[header.UUID] = &sendSpan{
+		span: span{
+			TraceID: traceID(header.UUID),
+			SpanID:  newSpanID(),
+			Name:    msgName + " send",
+			Kind:    SK_Producer,
+			Start:   unixNano(time.Now()),
+			Attributes: []keyValue{
+				stringAttr("msg.type", msgName),
+				stringAttr("msg.uuid", header.UUID),
+				intAttr("msg.author", header.AuthorID),
+				intAttr("node.id", nodeID),
+			},
+		},
+	}
+}
+
+/*
+ * Stamps the header of a message sent by this node,
+ * the event is "sent" the first time and "retransmit" after that
+ */
+func Transmit(header types.Header, eventName string) types.Header {
+	now := time.Now()
+
+	header.SenderID = nodeID
+	header.SentAt = now.UnixNano()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	s, exists := sending[header.UUID]
+
+	if !exists {
+		header.SpanID = newSpanID()
+		return header
+	}
+
+	if s.firstSent.IsZero() {
+		s.firstSent = now
+	}
+
+	if eventName == "retransmit" {
+		s.retransmits++
+	}
+
+	s.Events = append(s.Events, event{Time: unixNano(now), Name: eventName})
+	header.SpanID = s.SpanID
+
+	return header
+}
+
+/*
+ * Adds an event to the span of a message waiting for its reply
+ */
+func Event(uuid string, eventName string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	s, exists := sending[uuid]
+
+	if exists {
+		s.Events = append(s.Events, event{Time: unixNano(time.Now()), Name: eventName})
+	}
+}
+
+/*
+ * Ends the span of a message once it has completed the ring
+ */
+func Replied(uuid string) {
+	now := time.Now()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	s, exists := sending[uuid]
+
+	if !exists {
+		return
+	}
+
+	delete(sending, uuid)
+
+	s.End = unixNano(now)
+	s.Events = append(s.Events, event{Time: s.End, Name: "reply"})
+	s.Attributes = append(s.Attributes,
+		intAttr("msg.retransmits", s.retransmits),
+		doubleAttr("ring.latency_ms", milliseconds(now.Sub(s.firstSent))),
+	)
+
+	finish(s.span)
+}
+
+/*
+ * Records the hop of a message taken by this node, from when the previous
+ * node took it or sent it. The header is stamped so the hop is the parent
+ * of the next one if the message is forwarded.
+ * Hop latencies compare the clocks of two nodes.
+ */
+func Received(msgName string, header types.Header) types.Header {
+	now := time.Now()
+	sentAt := time.Unix(0, header.SentAt)
+
+	if header.SentAt == 0 {
+		sentAt = now
+	}
+
+	hop := span{
+		TraceID:      traceID(header.UUID),
+		SpanID:       newSpanID(),
+		ParentSpanID: header.SpanID,
+		Name:         msgName + " hop",
+		Kind:         SK_Consumer,
+		Start:        unixNano(sentAt),
+		End:          unixNano(now),
+		Attributes: []keyValue{
+			stringAttr("msg.type", msgName),
+			stringAttr("msg.uuid", header.UUID),
+			intAttr("msg.author", header.AuthorID),
+			intAttr("msg.loop_counter", header.LoopCounter),
+			intAttr("hop.sender", header.SenderID),
+			intAttr("hop.recipient", nodeID),
+			doubleAttr("hop.latency_ms", milliseconds(now.Sub(sentAt))),
+		},
+	}
+
+	lock.Lock()
+	if enabled {
+		finish(hop)
+	}
+	lock.Unlock()
+
+	header.SenderID = nodeID
+	header.SpanID = hop.SpanID
+	header.SentAt = now.UnixNano()
+
+	return header
+}
+
+/*
+ * Must hold the lock
+ */
+func finish(s span) {
+	if len(pending) >= MAX_PENDING {
+		pending = pending[1:]
+	}
+
+	pending = append(pending, s)
+}
+
+func export(file *os.File) {
+	encoder := json.NewEncoder(file)
+
+	for range time.Tick(EXPORT_PERIOD * time.Millisecond) {
+		lock.Lock()
+		spans := pending
+		pending = nil
+		lock.Unlock()
+
+		if len(spans) == 0 {
+			continue
+		}
+
+		err := encoder.Encode(map[string]any{
+			"resourceSpans": []any{
+				map[string]any{
+					"resource": map[string]any{
+						"attributes": []keyValue{
+							stringAttr("service.name", "elevator"),
+							intAttr("node.id", nodeID),
+						},
+					},
+					"scopeSpans": []any{
+						map[string]any{
+							"scope": map[string]string{"name": "elevator/trace"},
+							"spans": spans,
+						},
+					},
+				},
+			},
+		})
+
+		if err != nil {
+			slog.Error("Could not export trace spans", "count", len(spans), "err", err)
+		}
+	}
+}
+
+/*
+ * Every hop of a message shares the trace, the UUID is 16 bytes in hex
+ */
+func traceID(uuid string) string {
+	return strings.ToLower(strings.ReplaceAll(uuid, "-", ""))
+}
+
+func newSpanID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func stringAttr(key string, value string) keyValue {
+	return keyValue{Key: key, Value: map[string]any{"stringValue": value}}
+}
+
+func intAttr(key string, value int) keyValue {
+	return keyValue{Key: key, Value: map[string]any{"intValue": strconv.Itoa(value)}}
+}
+
+func doubleAttr(key string, value float64) keyValue {
+	return keyValue{Key: key, Value: map[string]any{"doubleValue": value}}
+}
@@ -0,0 +1,163 @@
+package traffic
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+)
+
+/*
+ * Share of the passengers travelling to or from the lobby
+ * during up-peak, down-peak and lunch traffic
+ */
+const PEAK_SHARE = 0.85
+const LUNCH_SHARE = 0.4
+
+var PATTERNS = []string{"uppeak", "downpeak", "lunch", "interfloor", "poisson"}
+
+/*
+ * Weight of each origin and destination pair, indexed [origin][destination]
+ */
+type odMatrix [][]float64
+
+func newOdMatrix(numFloors int) odMatrix {
+	matrix := make(odMatrix, numFloors)
+
+	for origin := range matrix {
+		matrix[origin] = make([]float64, numFloors)
+	}
+
+	return matrix
+}
+
+/*
+ * Spreads the weight evenly across every pair of different floors
+ */
+func (matrix odMatrix) addInterfloor(weight float64) {
+	numFloors := len(matrix)
+	numPairs := float64(numFloors * (numFloors - 1))
+
+	for origin := range matrix {
+		for destination := range matrix[origin] {
+			if origin != destination {
+				matrix[origin][destination] += weight / numPairs
+			}
+		}
+	}
+}
+
+func (matrix odMatrix) addFromLobby(weight float64, lobby int) {
+	for destination := range matrix[lobby] {
+		if destination != lobby {
+			matrix[lobby][destination] += weight / float64(len(matrix)-1)
+		}
+	}
+}
+
+func (matrix odMatrix) addToLobby(weight float64, lobby int) {
+	for origin := range matrix {
+		if origin != lobby {
+			matrix[origin][lobby] += weight / float64(len(matrix)-1)
+		}
+	}
+}
+
+/*
+ * Returns the origin and destination matrix of a traffic pattern.
+ * The poisson pattern reads the arrival rate of each pair from a JSON file.
+ */
+func patternMatrix(pattern string, numFloors int, lobby int, odFile string) (odMatrix, error) {
+	matrix := newOdMatrix(numFloors)
+
+	switch pattern {
+	case "uppeak":
+		matrix.addFromLobby(PEAK_SHARE, lobby)
+		matrix.addInterfloor(1 - PEAK_SHARE)
+
+	case "downpeak":
+		matrix.addToLobby(PEAK_SHARE, lobby)
+		matrix.addInterfloor(1 - PEAK_SHARE)
+
+	case "lunch":
+		matrix.addFromLobby(LUNCH_SHARE, lobby)
+		matrix.addToLobby(LUNCH_SHARE, lobby)
+		matrix.addInterfloor(1 - 2*LUNCH_SHARE)
+
+	case "interfloor":
+		matrix.addInterfloor(1)
+
+	case "poisson":
+		return readOdMatrix(odFile, numFloors)
+
+	default:
+		return nil, fmt.Errorf("unknown traffic pattern %q", pattern)
+	}
+
+	return matrix, nil
+}
+
+func readOdMatrix(odFile string, numFloors int) (odMatrix, error) {
+	if len(odFile) == 0 {
+		return nil, fmt.Errorf("the poisson pattern needs an origin and destination matrix, see flag -od")
+	}
+
+	encodedMatrix, err := os.ReadFile(odFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var matrix odMatrix
+
+	err = json.Unmarshal(encodedMatrix, &matrix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(matrix) != numFloors {
+		return nil, fmt.Errorf("origin and destination matrix must have %d rows", numFloors)
+	}
+
+	for origin := range matrix {
+		if len(matrix[origin]) != numFloors {
+			return nil, fmt.Errorf("origin and destination matrix must have %d columns", numFloors)
+		}
+
+		matrix[origin][origin] = 0
+	}
+
+	return matrix, nil
+}
+
+func (matrix odMatrix) total() float64 {
+	sum := 0.0
+
+	for origin := range matrix {
+		for _, weight := range matrix[origin] {
+			sum += weight
+		}
+	}
+
+	return sum
+}
+
+/*
+ * Draws an origin and destination pair with probability proportional to its weight
+ */
+func (matrix odMatrix) sample(random *rand.Rand) (int, int) {
+	target := random.Float64() * matrix.total()
+
+	for origin := range matrix {
+		for destination, weight := range matrix[origin] {
+			target -= weight
+
+			if 0 > target && weight > 0 {
+				return origin, destination
+			}
+		}
+	}
+
+	return 0, len(matrix) - 1
+}
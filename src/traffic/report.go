@@ -0,0 +1,75 @@
+package traffic
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+type distribution struct {
+	mean time.Duration
+	p50  time.Duration
+	p90  time.Duration
+	p95  time.Duration
+	max  time.Duration
+}
+
+func newDistribution(durations []time.Duration) distribution {
+	if len(durations) == 0 {
+		return distribution{}
+	}
+
+	slices.Sort(durations)
+
+	var sum time.Duration
+
+	for _, duration := range durations {
+		sum += duration
+	}
+
+	return distribution{
+		mean: sum / time.Duration(len(durations)),
+		p50:  percentile(durations, 50),
+		p90:  percentile(durations, 90),
+		p95:  percentile(durations, 95),
+		max:  durations[len(durations)-1],
+	}
+}
+
+/*
+ * Nearest rank percentile of sorted durations
+ */
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+
+	return sorted[max(rank, 1)-1]
+}
+
+func (d distribution) String() string {
+	return fmt.Sprintf("mean %5.1f s | p50 %5.1f s | p90 %5.1f s | p95 %5.1f s | max %5.1f s",
+		d.mean.Seconds(),
+		d.p50.Seconds(),
+		d.p90.Seconds(),
+		d.p95.Seconds(),
+		d.max.Seconds(),
+	)
+}
+
+/*
+ * Waiting time is from arrival until boarding,
+ * journey time is from arrival until reaching the destination
+ */
+func report(delivered []*passenger, numWaiting int, numRiding int) {
+	var waitTimes []time.Duration
+	var journeyTimes []time.Duration
+
+	for _, p := range delivered {
+		waitTimes = append(waitTimes, p.boardedAt.Sub(p.arrivedAt))
+		journeyTimes = append(journeyTimes, p.deliveredAt.Sub(p.arrivedAt))
+	}
+
+	fmt.Println()
+	fmt.Printf("Delivered: %d | Still waiting: %d | Still riding: %d\n", len(delivered), numWaiting, numRiding)
+	fmt.Println("Waiting time: ", newDistribution(waitTimes))
+	fmt.Println("Journey time: ", newDistribution(journeyTimes))
+}
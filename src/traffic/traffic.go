@@ -0,0 +1,272 @@
+package traffic
+
+import (
+	"Driver-go/elevio"
+	"Network-go/bcast"
+	"elevator/types"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+ * Time given to the cars to deliver the remaining passengers
+ * after the generator has stopped creating new ones
+ */
+const DRAIN_TIMEOUT = 120 // s
+
+type passenger struct {
+	origin      int
+	destination int
+	car         int
+	arrivedAt   time.Time
+	boardedAt   time.Time
+	deliveredAt time.Time
+}
+
+type settings struct {
+	numNodes  int
+	numFloors int
+	pattern   string
+	rate      float64
+	duration  int
+	lobby     int
+	odFile    string
+	capacity  int
+	seed      int64
+}
+
+func parseFlags(args []string) settings {
+	flags := flag.NewFlagSet("traffic", flag.ExitOnError)
+
+	numNodes := flags.Int("num", -1, "Number of nodes")
+	numFloors := flags.Int("floors", 4, "Number of floors")
+	pattern := flags.String("pattern", "interfloor", "Traffic pattern: "+strings.Join(PATTERNS, ", "))
+	rate := flags.Float64("rate", 6, "Passengers per minute, ignored by the poisson pattern")
+	duration := flags.Int("duration", 300, "Seconds to generate passengers for")
+	lobby := flags.Int("lobby", 0, "Lobby floor")
+	odFile := flags.String("od", "", "JSON file with the passengers per minute from each floor (row) to each floor (column)")
+	capacity := flags.Int("capacity", 8, "Passengers each car takes, the others wait for the next car")
+	seed := flags.Int64("seed", time.Now().UnixNano(), "Random seed")
+
+	flags.Parse(args)
+
+	if *numNodes < 1 || *numFloors < 2 || *lobby < 0 || *lobby >= *numFloors || *capacity < 1 {
+		fmt.Println("Invalid flags, use flag -h to see usage")
+		os.Exit(1)
+	}
+
+	return settings{
+		numNodes:  *numNodes,
+		numFloors: *numFloors,
+		pattern:   *pattern,
+		rate:      *rate,
+		duration:  *duration,
+		lobby:     *lobby,
+		odFile:    *odFile,
+		capacity:  *capacity,
+		seed:      *seed,
+	}
+}
+
+/*
+ * Generates passengers and presses their buttons on the nodes started with flag -inject.
+ * A passenger boards the car serving its hall call, presses its destination in that car,
+ * and leaves when the cab call is served. Served orders are read from the ring messages.
+ * Passengers who do not fit in the car press the hall button again, and the number
+ * of passengers in each car is sent to its node in place of a load sensor.
+ */
+func Run(args []string, bcastPort int, injectPort int) {
+	s := parseFlags(args)
+
+	matrix, err := patternMatrix(s.pattern, s.numFloors, s.lobby, s.odFile)
+
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	/*
+	 * A read matrix holds the rates, a pattern matrix the share of each pair
+	 */
+	rate := s.rate
+
+	if s.pattern == "poisson" {
+		rate = matrix.total()
+	}
+
+	if rate <= 0 {
+		fmt.Println("Error: arrival rate must be positive")
+		os.Exit(1)
+	}
+
+	random := rand.New(rand.NewSource(s.seed))
+
+	injectTx := make(chan types.InjectedButton)
+	loadTx := make(chan types.InjectedLoad)
+	servedRx := make(chan types.Msg[types.Served])
+
+	go bcast.Transmitter(injectPort, injectTx, loadTx)
+	go bcast.Receiver(bcastPort, servedRx)
+
+	var waiting []*passenger
+	var riding []*passenger
+	var delivered []*passenger
+
+	seen := make(map[string]bool)
+	nextNode := 0
+
+	arrival := time.After(interarrival(random, rate))
+	stop := time.After(time.Duration(s.duration) * time.Second)
+
+	var drain <-chan time.Time
+
+	fmt.Printf("Generating %s traffic, %.1f passengers per minute for %d s\n", s.pattern, rate, s.duration)
+
+	for {
+		select {
+		case <-arrival:
+			arrival = time.After(interarrival(random, rate))
+
+			origin, destination := matrix.sample(random)
+
+			p := &passenger{
+				origin:      origin,
+				destination: destination,
+				car:         -1,
+				arrivedAt:   time.Now(),
+			}
+
+			waiting = append(waiting, p)
+
+			/*
+			 * Spread the hall calls over the nodes, as if each
+			 * node was wired to the hall buttons of some floors
+			 */
+			injectTx <- types.InjectedButton{
+				NodeID: nextNode,
+				Button: elevio.ButtonEvent{Floor: origin, Button: callDirection(p)},
+			}
+
+			nextNode = (nextNode + 1) % s.numNodes
+
+		case <-stop:
+			arrival = nil
+			drain = time.After(DRAIN_TIMEOUT * time.Second)
+
+			fmt.Printf("Stopped generating, waiting for %d passengers\n", len(waiting)+len(riding))
+
+		case <-drain:
+			report(delivered, len(waiting), len(riding))
+			return
+
+		case served := <-servedRx:
+			order := served.Content.Order
+
+			/*
+			 * Every node passes the message on, only handle the first copy
+			 */
+			if seen[order.ID] {
+				continue
+			}
+			seen[order.ID] = true
+
+			car := served.Header.AuthorID
+			now := time.Now()
+
+			if order.Button == elevio.BT_Cab {
+				var stillRiding []*passenger
+
+				for _, p := range riding {
+					if p.car == car && p.destination == order.Floor {
+						p.deliveredAt = now
+						delivered = append(delivered, p)
+					} else {
+						stillRiding = append(stillRiding, p)
+					}
+				}
+
+				riding = stillRiding
+
+				loadTx <- types.InjectedLoad{NodeID: car, Passengers: passengersIn(riding, car)}
+			} else {
+				var stillWaiting []*passenger
+				leftBehind := false
+
+				for _, p := range waiting {
+					if p.origin != order.Floor || callDirection(p) != order.Button {
+						stillWaiting = append(stillWaiting, p)
+						continue
+					}
+
+					if passengersIn(riding, car) >= s.capacity {
+						stillWaiting = append(stillWaiting, p)
+						leftBehind = true
+						continue
+					}
+
+					p.car = car
+					p.boardedAt = now
+					riding = append(riding, p)
+
+					injectTx <- types.InjectedButton{
+						NodeID: car,
+						Button: elevio.ButtonEvent{Floor: p.destination, Button: elevio.BT_Cab},
+					}
+				}
+
+				waiting = stillWaiting
+
+				loadTx <- types.InjectedLoad{NodeID: car, Passengers: passengersIn(riding, car)}
+
+				/*
+				 * The car is unavailable at full load, so the call goes to another car
+				 */
+				if leftBehind {
+					injectTx <- types.InjectedButton{
+						NodeID: nextNode,
+						Button: elevio.ButtonEvent{Floor: order.Floor, Button: order.Button},
+					}
+
+					nextNode = (nextNode + 1) % s.numNodes
+				}
+			}
+
+			if drain != nil && len(waiting) == 0 && len(riding) == 0 {
+				report(delivered, 0, 0)
+				return
+			}
+		}
+	}
+}
+
+func passengersIn(riding []*passenger, car int) int {
+	count := 0
+
+	for _, p := range riding {
+		if p.car == car {
+			count++
+		}
+	}
+
+	return count
+}
+
+func callDirection(p *passenger) elevio.ButtonType {
+	if p.destination > p.origin {
+		return elevio.BT_HallUp
+	}
+	return elevio.BT_HallDown
+}
+
+/*
+ * Time until the next passenger arrives, arrivals form a Poisson process
+ */
+func interarrival(random *rand.Rand, ratePerMinute float64) time.Duration {
+	minutes := random.ExpFloat64() / ratePerMinute
+
+	return time.Duration(minutes * float64(time.Minute))
+}
@@ -2,21 +2,177 @@ package types
 
 import "Driver-go/elevio"
 
-type Order = elevio.ButtonEvent
+type OfflinePolicy int
 
+const (
+	OP_Ignore OfflinePolicy = iota
+	OP_Serve
+)
+
+type MaintenancePolicy int
+
+const (
+	MP_Finish MaintenancePolicy = iota
+	MP_Drop
+)
+
+/*
+ * Traffic mode of the group, switched on a calendar
+ */
+type TrafficMode int
+
+const (
+	TM_Normal TrafficMode = iota
+	TM_UpPeak
+	TM_DownPeak
+	TM_Night
+)
+
+func (mode TrafficMode) String() string {
+	switch mode {
+	case TM_Normal:
+		return "normal"
+	case TM_UpPeak:
+		return "uppeak"
+	case TM_DownPeak:
+		return "downpeak"
+	case TM_Night:
+		return "night"
+	}
+	return "unknown"
+}
+
+/*
+ * HallLightGuarantee: hall lights are only turned on once
+ * every live node has acknowledged the order
+ *
+ * OfflinePolicy: whether hall calls are ignored or served
+ * by the car itself while the node is disconnected
+ *
+ * MaintenanceFloor: floor the car parks at with the door open
+ * while out of service
+ *
+ * MaintenancePolicy: whether cab orders are served or dropped
+ * when the car is taken out of service
+ *
+ * RecallFloor: floor every car is sent to on a fire recall
+ *
+ * NumFloors: floors the shaft of the car reaches, from the bottom floor
+ *
+ * ServedFloors: floors the car stops at, every floor if nil
+ *
+ * TravelTime: ms between two floors until the travel times are measured
+ *
+ * Capacity: number of passengers the car takes
+ */
 type ElevConfig struct {
-	NodeID           int
-	NumNodes         int
-	NumFloors        int
-	NumButtons       int
-	DoorOpenDuration int
+	NodeID             int
+	NumNodes           int
+	NumFloors          int
+	NumButtons         int
+	DoorOpenDuration   int
+	HallLightGuarantee bool
+	OfflinePolicy      OfflinePolicy
+	MaintenanceFloor   int
+	MaintenancePolicy  MaintenancePolicy
+	RecallFloor        int
+	ServedFloors       []bool
+	TravelTime         int
+	Capacity           int
 }
 
+/*
+ * FireRecall: Phase I fire recall is active in the ring
+ *
+ * FireService: Phase II, the car is operated by a firefighter
+ *
+ * DoorCloseHeld: the door close input is held down
+ *
+ * ParkingFloor: floor the idle car parks at, -1 if none
+ *
+ * TrafficMode: the mode agreed in the ring
+ *
+ * PoweredDown: parked for the night, only cab calls wake the car
+ *
+ * Load: weight in the car in percent of its rated load
+ *
+ * FullLoad: the car is too full to take more passengers,
+ * so it passes hall calls without stopping
+ */
 type ElevState struct {
 	Floor              int
 	Dirn               elevio.MotorDirection
 	StuckBetweenFloors bool
 	DoorObstr          bool
-	Orders             [][][]bool
+	DoorOpen           bool
+	Orders             OrderRegistry
 	NextNodeID         int
+	PendingHandover    bool
+	TravelTimes        TravelTimes
+	FloorArrivedAt     int64
+	OutOfService       bool
+	IndependentService bool
+	FireRecall         bool
+	FireService        bool
+	DoorCloseHeld      bool
+	ParkingFloor       int
+	TrafficMode        TrafficMode
+	PoweredDown        bool
+	Load               int
+	FullLoad           bool
+}
+
+/*
+ * Snapshot of a car used when assigning orders on behalf of other nodes.
+ * Available is false if the car can not take new orders.
+ * The car advertises its own travel and door times, floors and capacity,
+ * as the cars of the group need not be alike.
+ */
+type CarState struct {
+	NodeID           int
+	Floor            int
+	Dirn             elevio.MotorDirection
+	Behaviour        ElevBehaviour
+	Available        bool
+	Travel           TravelTimes
+	NumFloors        int
+	ServedFloors     []bool
+	TravelTime       int
+	DoorOpenDuration int
+	Capacity         int
+	Load             int
+}
+
+/*
+ * Broadcast periodically by every node for monitoring.
+ * Orders holds the active orders assigned to the car,
+ * ParkingFloor is -1 unless the car is parked or on its way to park.
+ */
+type CarStatus struct {
+	NodeID       int
+	NextNodeID   int
+	NumFloors    int
+	Floor        int
+	Dirn         elevio.MotorDirection
+	Behaviour    ElevBehaviour
+	DoorObstr    bool
+	Stuck        bool
+	OutOfService bool
+	Independent  bool
+	FireRecall   bool
+	FireService  bool
+	ParkingFloor int
+	PoweredDown  bool
+	Load         int
+	Orders       []elevio.ButtonEvent
+}
+
+/*
+ * Measured times in ms, 0 where nothing has been measured yet.
+ * Segments[i] is the travel time between floor i and i+1.
+ */
+type TravelTimes struct {
+	Segments     []int
+	DoorDwell    int
+	StopOverhead int
 }
@@ -12,6 +12,18 @@ const (
 	EB_Moving
 )
 
+func (behaviour ElevBehaviour) String() string {
+	switch behaviour {
+	case EB_Idle:
+		return "idle"
+	case EB_DoorOpen:
+		return "door open"
+	case EB_Moving:
+		return "moving"
+	}
+	return "unknown"
+}
+
 type FsmOutput struct {
 	ElevDirn       elevio.MotorDirection
 	MotorDirn      elevio.MotorDirection
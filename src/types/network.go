@@ -1,5 +1,7 @@
 package types
 
+import "Driver-go/elevio"
+
 type MsgTypes int
 
 const (
@@ -24,34 +26,116 @@ type Bid struct {
 	OldAssignee  int
 }
 
+/*
+ * Acknowledged is set when the author sends the assignment
+ * around the ring a second time, after every node has received it
+ */
 type Assign struct {
-	Order       Order
-	NewAssignee int
-	OldAssignee int
+	Order        Order
+	NewAssignee  int
+	OldAssignee  int
+	Acknowledged bool
 }
 
 type Served struct {
 	Order Order
 }
 
+/*
+ * A served or cancelled order, sent in a sync instead of the order.
+ * State is the final state of the order and ClosedAt when it was
+ * served or cancelled. HeldBy has a bit set for every node known
+ * to hold the tombstone.
+ */
+type Tombstone struct {
+	State    OrderState
+	Version  int
+	ClosedAt int64
+	HeldBy   uint32
+}
+
+/*
+ * The registry is sent around the ring in chunks, each holding the
+ * unserved orders with an ID from From up to, but not including, To.
+ * An empty To has no upper bound. Served and cancelled orders are
+ * only sent as tombstones, indexed by order ID.
+ */
 type Sync struct {
-	Orders   [][][]bool
-	TargetID int
+	Orders     OrderRegistry
+	Tombstones map[string]Tombstone
+	From       string
+	To         string
+	TargetID   int
+}
+
+/*
+ * Every node fills in the state of its car on the way around the ring.
+ * A census too long for one broadcast is split in chunks of cars,
+ * Last is set on the last chunk.
+ */
+type Census struct {
+	Cars []CarState
+	Last bool
+}
+
+/*
+ * Fire recall, Phase I, for every car in the ring.
+ * Recall is false when the recall is reset.
+ */
+type Fire struct {
+	Recall bool
+}
+
+/*
+ * Traffic mode of the group, sent by the coordinator when its calendar
+ * switches mode and to cars joining the ring
+ */
+type Mode struct {
+	Mode TrafficMode
+}
+
+/*
+ * New assignee of each reassigned order indexed by order ID
+ */
+type Reassign struct {
+	Assignments map[string]int
 }
 
 /*
  * Header must have a fixed size
  * -> AuthorID must be btween 0 and 9
+ *
+ * SenderID, SpanID and SentAt describe the last hop, for tracing
  */
 type Header struct {
 	AuthorID  int
 	Recipient int
 	UUID      string
 	LoopCounter int
+	SenderID  int
+	SpanID    string
+	SentAt    int64
 }
 
 type Content interface {
-	Bid | Assign | Served | Sync
+	Bid | Assign | Served | Sync | Census | Reassign | Fire | Mode
+}
+
+/*
+ * Button press injected into a node by the traffic generator
+ */
+type InjectedButton struct {
+	NodeID int
+	Button elevio.ButtonEvent
+}
+
+/*
+ * Number of passengers in a car, sent by the traffic generator
+ * in place of a load sensor
+ */
+type InjectedLoad struct {
+	NodeID     int
+	Passengers int
 }
 
 type Msg[T Content] struct {
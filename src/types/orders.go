@@ -6,3 +6,74 @@ type DirnBehaviourPair struct {
 	Dirn      elevio.MotorDirection
 	Behaviour ElevBehaviour
 }
+
+type OrderState int
+
+const (
+	OS_Unconfirmed OrderState = iota
+	OS_Assigned
+	OS_Serving
+	OS_Served
+	OS_Cancelled
+)
+
+/*
+ * An order is identified by its ID on every node.
+ * Version is incremented every time the order changes,
+ * which lets nodes tell which copy of an order is the most recent.
+ * Acknowledged is set once the assignment has been around the ring.
+ * Timestamps are unix milliseconds, 0 until the event has happened.
+ * ArrivedAt is when the serving car reached the floor of the order,
+ * ServedAt when it opened the door there,
+ * and Reassignments counts how many times the order changed car.
+ * HeldBy has a bit set for every node known to hold the order
+ * as served or cancelled, see orders.Prune.
+ */
+type Order struct {
+	elevio.ButtonEvent
+	ID            string
+	Origin        int
+	Assignee      int
+	State         OrderState
+	Version       int
+	Acknowledged  bool
+	CreatedAt     int64
+	AssignedAt    int64
+	ArrivedAt     int64
+	ServedAt      int64
+	CancelledAt   int64
+	Reassignments int
+	HeldBy        uint32
+}
+
+/*
+ * All orders known to a node indexed by order ID
+ */
+type OrderRegistry map[string]Order
+
+/*
+ * Active orders of a single car, one bit per button on each floor
+ */
+type CarOrders []uint8
+
+func (carOrders CarOrders) Has(floor int, btn elevio.ButtonType) bool {
+	return 0 <= floor && floor < len(carOrders) && carOrders[floor]&(1<<btn) != 0
+}
+
+func (carOrders CarOrders) Set(floor int, btn elevio.ButtonType) {
+	carOrders[floor] |= 1 << btn
+}
+
+func (carOrders CarOrders) Clear(floor int, btn elevio.ButtonType) {
+	carOrders[floor] &^= 1 << btn
+}
+
+func (carOrders CarOrders) Empty() bool {
+	for _, buttons := range carOrders {
+		if buttons != 0 {
+			return false
+		}
+	}
+
+	return true
+}
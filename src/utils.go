@@ -1,20 +1,97 @@
 package main
 
 import (
+	"elevator/api"
+	"elevator/dispatch"
+	"elevator/fsm"
+	"elevator/logging"
+	"elevator/orders"
+	"elevator/parking"
+	"elevator/schedule"
 	"elevator/types"
 	"flag"
 	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
 	"os"
 	"slices"
+	"strconv"
+	"strings"
 )
 
+type cmdFlags struct {
+	nodeID             int
+	numNodes           int
+	numFloors          int
+	elevServerPort     int
+	hallLightGuarantee bool
+	offlinePolicy      types.OfflinePolicy
+	maintenanceFloor   int
+	maintenancePolicy  types.MaintenancePolicy
+	maintenance        bool
+	keySwitch          bool
+	loadSensor         bool
+	recallFloor        int
+	servedFloors       []bool
+	travelTime         int
+	doorOpenDuration   int
+	capacity           int
+	parking            parking.Config
+	calendarSpec       string
+	calendar           schedule.Calendar
+	dispatchStrategy   string
+	dispatcher         dispatch.Dispatcher
+	calibReport        string
+	inject             bool
+	kpiReport          string
+	httpAddr           string
+	apiToken           string
+	journal            string
+	traceFile          string
+	logConfig          logging.Config
+}
+
 /*
  * Parse command line arguments
  */
-func parseCommandlineFlags() (int, int, int) {
+func parseCommandlineFlags() cmdFlags {
 	nodeID := flag.Int("id", -1, "Node id")
 	numNodes := flag.Int("num", -1, "Number of nodes")
 	elevServerPort := flag.Int("sport", -1, "Elevator server port")
+	hallLightGuarantee := flag.Bool("guarantee", false, "Only light hall buttons once every node has acknowledged the order")
+	offlinePolicy := flag.String("offline", "ignore", "Hall calls while disconnected: ignore or serve")
+	maintenanceFloor := flag.Int("maintfloor", 0, "Floor the car parks at with the door open while out of service")
+	maintenancePolicy := flag.String("maintcabs", "finish", "Cab calls when taken out of service: finish or drop")
+	maintenance := flag.Bool("maintenance", false, "Start out of service")
+	keySwitch := flag.Bool("keyswitch", false, "Use the stop button as the maintenance key switch")
+	loadSensor := flag.Bool("loadsensor", false, "Read the load of the car from an elevator server with a load sensor")
+	recallFloor := flag.Int("recallfloor", 0, "Floor every car is sent to on a fire recall")
+	travelTime := flag.Int("travel", fsm.TRAVEL_TIME, "Milliseconds the car takes between two floors, until it has measured them")
+	doorOpenDuration := flag.Int("door", DOOR_OPEN_DURATION, "Milliseconds the door is held open")
+	capacity := flag.Int("capacity", CAPACITY, "Number of passengers the car takes")
+	numFloors := flag.Int("floors", NUM_FLOORS, "Number of floors the shaft of the car reaches, from the bottom floor")
+	zones := flag.String("zones", "", "Named sets of floors, eg. \"low=0-1; express=0,3\"")
+	serves := flag.String("serves", "", "Floors and zones the car serves, eg. 1-3 or express. Every floor if empty")
+	parkStrategy := flag.String("park", "none", "Where idle cars park: none, home or zones")
+	homeFloor := flag.Int("homefloor", 0, "Floor idle cars return to with -park home")
+	parkAfter := flag.Int("parkafter", 30, "Seconds a car waits idle before it goes to park")
+	lobby := flag.Int("lobby", 0, "Lobby floor")
+	lobbyHours := flag.String("lobbyhours", "", "Hours of the day one idle car parks at the lobby, eg. 7-10")
+	calendarSpec := flag.String("calendar", "", "Traffic modes of the group by time of day, eg. \"uppeak 7-10 mon-fri, night 23-6\"")
+	calibReport := flag.String("calib", "", "File to write the travel time calibration report to")
+	kpiReport := flag.String("kpi", "", "File to write the service KPIs to, as CSV if it ends in .csv, otherwise JSON")
+	httpAddr := flag.String("http", "", "Address to serve the metrics and the API on, eg. :8080")
+	apiToken := flag.String("token", "", "Token required by the API endpoints which control the node")
+	logLevel := flag.String("loglevel", "info", "Log level: debug, info, warn or error")
+	logFile := flag.String("logfile", "", "File to log to instead of stderr")
+	logJson := flag.Bool("logjson", false, "Log as JSON")
+	logSize := flag.Int("logsize", 10, "Megabytes a log file may grow to before it is rotated")
+	logBackups := flag.Int("logbackups", 3, "Rotated log files to keep")
+	journal := flag.String("journal", "", "File to record every input to, for elevator replay")
+	traceFile := flag.String("trace", "", "File to write trace spans of the ring messages to, as OpenTelemetry JSON")
+	inject := flag.Bool("inject", false, "Accept button presses and passenger counts from the traffic generator")
+	dispatchStrategy := flag.String("dispatch", dispatch.DEFAULT, "Dispatch strategy: "+strings.Join(dispatch.Names(), ", "))
 
 	flag.Parse()
 
@@ -23,30 +100,259 @@ func parseCommandlineFlags() (int, int, int) {
 		os.Exit(1)
 	}
 
-	return *nodeID, *numNodes, *elevServerPort
+	policies := map[string]types.OfflinePolicy{
+		"ignore": types.OP_Ignore,
+		"serve":  types.OP_Serve,
+	}
+
+	if _, valid := policies[*offlinePolicy]; !valid {
+		fmt.Println("Invalid offline policy, use flag -h to see usage")
+		os.Exit(1)
+	}
+
+	maintenancePolicies := map[string]types.MaintenancePolicy{
+		"finish": types.MP_Finish,
+		"drop":   types.MP_Drop,
+	}
+
+	if _, valid := maintenancePolicies[*maintenancePolicy]; !valid {
+		fmt.Println("Invalid maintenance policy, use flag -h to see usage")
+		os.Exit(1)
+	}
+
+	if *travelTime <= 0 || *doorOpenDuration <= 0 || *capacity <= 0 {
+		fmt.Println("Invalid travel time, door time or capacity, use flag -h to see usage")
+		os.Exit(1)
+	}
+
+	if *numFloors < 2 || *numFloors > NUM_FLOORS {
+		fmt.Println("Invalid number of floors, use flag -h to see usage")
+		os.Exit(1)
+	}
+
+	servedFloors, err := parseServedFloors(*serves, *zones, *numFloors)
+
+	if err != nil {
+		fmt.Println("Invalid served floors:", err)
+		os.Exit(1)
+	}
+
+	if *maintenanceFloor < 0 || *maintenanceFloor >= *numFloors {
+		fmt.Println("Invalid maintenance floor, use flag -h to see usage")
+		os.Exit(1)
+	}
+
+	if !orders.Serves(servedFloors, *maintenanceFloor) {
+		fmt.Println("The car does not serve the maintenance floor")
+		os.Exit(1)
+	}
+
+	if *recallFloor < 0 || *recallFloor >= *numFloors {
+		fmt.Println("Invalid recall floor, use flag -h to see usage")
+		os.Exit(1)
+	}
+
+	parkStrategies := map[string]parking.Strategy{
+		"none":  parking.PS_None,
+		"home":  parking.PS_Home,
+		"zones": parking.PS_Zones,
+	}
+
+	if _, valid := parkStrategies[*parkStrategy]; !valid {
+		fmt.Println("Invalid parking strategy, use flag -h to see usage")
+		os.Exit(1)
+	}
+
+	if *homeFloor < 0 || *homeFloor >= *numFloors || *lobby < 0 || *lobby >= *numFloors || *parkAfter < 0 {
+		fmt.Println("Invalid parking floor or time, use flag -h to see usage")
+		os.Exit(1)
+	}
+
+	lobbyFrom, lobbyTo, valid := schedule.ParseHours(*lobbyHours)
+
+	if !valid {
+		fmt.Println("Invalid lobby hours, use flag -h to see usage")
+		os.Exit(1)
+	}
+
+	calendar, err := schedule.Parse(*calendarSpec)
+
+	if err != nil {
+		fmt.Println("Invalid calendar:", err)
+		os.Exit(1)
+	}
+
+	if !logging.ValidLevel(*logLevel) {
+		fmt.Println("Invalid log level, use flag -h to see usage")
+		os.Exit(1)
+	}
+
+	dispatcher, valid := dispatch.New(*dispatchStrategy)
+
+	if !valid {
+		fmt.Println("Invalid dispatch strategy, use flag -h to see usage")
+		os.Exit(1)
+	}
+
+	return cmdFlags{
+		nodeID:             *nodeID,
+		numNodes:           *numNodes,
+		numFloors:          *numFloors,
+		elevServerPort:     *elevServerPort,
+		hallLightGuarantee: *hallLightGuarantee,
+		offlinePolicy:      policies[*offlinePolicy],
+		maintenanceFloor:   *maintenanceFloor,
+		maintenancePolicy:  maintenancePolicies[*maintenancePolicy],
+		maintenance:        *maintenance,
+		keySwitch:          *keySwitch,
+		loadSensor:         *loadSensor,
+		recallFloor:        *recallFloor,
+		servedFloors:       servedFloors,
+		travelTime:         *travelTime,
+		doorOpenDuration:   *doorOpenDuration,
+		capacity:           *capacity,
+		calendarSpec:       *calendarSpec,
+		calendar:           calendar,
+		dispatchStrategy:   *dispatchStrategy,
+		dispatcher:         dispatcher,
+		calibReport:        *calibReport,
+		inject:             *inject,
+		kpiReport:          *kpiReport,
+		httpAddr:           *httpAddr,
+		apiToken:           *apiToken,
+		journal:            *journal,
+		traceFile:          *traceFile,
+		parking: parking.Config{
+			Strategy:  parkStrategies[*parkStrategy],
+			HomeFloor: *homeFloor,
+			IdleTime:  *parkAfter * 1000,
+			Lobby:     *lobby,
+			LobbyFrom: lobbyFrom,
+			LobbyTo:   lobbyTo,
+		},
+		logConfig: logging.Config{
+			Level:      *logLevel,
+			File:       *logFile,
+			Json:       *logJson,
+			MaxSize:    *logSize,
+			MaxBackups: *logBackups,
+		},
+	}
 }
 
 /*
- * Find the index of the lowest value that is not -1
+ * Parses the floors served by the car, such as "0,2-3" or the name of a zone.
+ * Zones are given as "low=0-1; express=0,3". Every floor the car reaches
+ * is served if empty.
  */
-func minTimeToServed(timeToServed []int) int {
-	result := slices.Max(timeToServed)
+func parseServedFloors(serves string, zones string, numFloors int) ([]bool, error) {
+	if len(strings.TrimSpace(serves)) == 0 {
+		servedFloors := make([]bool, numFloors)
 
-	for _, value := range timeToServed {
-		if 0 > value {
+		for floor := range servedFloors {
+			servedFloors[floor] = true
+		}
+
+		return servedFloors, nil
+	}
+
+	zoneFloors := make(map[string]string)
+
+	for _, zone := range strings.Split(zones, ";") {
+		if len(strings.TrimSpace(zone)) == 0 {
 			continue
-		} else if value < result {
-			result = value
 		}
+
+		name, floors, found := strings.Cut(zone, "=")
+
+		if !found {
+			return nil, fmt.Errorf("invalid zone %q", zone)
+		}
+
+		zoneFloors[strings.TrimSpace(name)] = floors
+	}
+
+	servedFloors := make([]bool, numFloors)
+
+	var addFloors func(floors string, inZone bool) error
+
+	addFloors = func(floors string, inZone bool) error {
+		for _, item := range strings.Split(floors, ",") {
+			item = strings.TrimSpace(item)
+
+			if zone, exists := zoneFloors[item]; exists && !inZone {
+				err := addFloors(zone, true)
+
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			first, last, isRange := strings.Cut(item, "-")
+
+			if !isRange {
+				last = first
+			}
+
+			firstFloor, errFirst := strconv.Atoi(first)
+			lastFloor, errLast := strconv.Atoi(last)
+
+			if errFirst != nil || errLast != nil || firstFloor < 0 || lastFloor >= numFloors || firstFloor > lastFloor {
+				return fmt.Errorf("invalid floors %q", item)
+			}
+
+			for floor := firstFloor; floor <= lastFloor; floor++ {
+				servedFloors[floor] = true
+			}
+		}
+
+		return nil
+	}
+
+	err := addFloors(serves, false)
+
+	if err != nil {
+		return nil, err
 	}
 
-	return slices.Index(timeToServed, result)
+	return servedFloors, nil
+}
+
+func serveHttp(addr string, handler http.Handler) {
+	err := http.ListenAndServe(addr, handler)
+
+	if err != nil {
+		slog.Error("HTTP server stopped", "addr", addr, "err", err)
+	}
+}
+
+/*
+ * Copies the state, as the API encodes it outside of the main loop
+ */
+func nodeStatus(
+	elevState *types.ElevState,
+	elevConfig *types.ElevConfig,
+	livePeers []string,
+) api.Status {
+
+	state := *elevState
+	state.Orders = maps.Clone(elevState.Orders)
+
+	return api.Status{
+		Config:    *elevConfig,
+		State:     state,
+		Behaviour: fsm.Behaviour(),
+		Peers:     slices.Clone(livePeers),
+	}
 }
 
-func printNextNode(elevState *types.ElevState, elevConfig *types.ElevConfig) {
-	fmt.Print("\033[2J\033[2;0H\r  ")
-	fmt.Printf("ID: %d | NextID: %d \n\n",
-		elevConfig.NodeID,
-		elevState.NextNodeID,
+func logReceived(msgName string, header types.Header) {
+	slog.Debug("Message received",
+		"msg", msgName,
+		"uuid", header.UUID,
+		"author", header.AuthorID,
+		"loop", header.LoopCounter,
 	)
 }